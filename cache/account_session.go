@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/vicanso/beginner/config"
+	"github.com/vicanso/beginner/util"
+)
+
+var sessionConfig = config.MustGetSessionConfig()
+
+// 账号对应的session id列表的key
+func getAccountSessionKey(account string) string {
+	return "ss:account:" + account
+}
+
+// AddAccountSession 记录账号对应的session id，用于撤销账号所有的session
+func AddAccountSession(ctx context.Context, account, id string) error {
+	key := getAccountSessionKey(account)
+	pipe := redisClient.TxPipeline()
+	pipe.SAdd(ctx, key, id)
+	// 有效期与session一致，每次登录时刷新
+	pipe.Expire(ctx, key, sessionConfig.TTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// RemoveAccountSession 删除账号对应的session id
+func RemoveAccountSession(ctx context.Context, account, id string) error {
+	return redisClient.SRem(ctx, getAccountSessionKey(account), id).Err()
+}
+
+// ListAccountSessions 获取账号对应的所有session id
+func ListAccountSessions(ctx context.Context, account string) ([]string, error) {
+	return redisClient.SMembers(ctx, getAccountSessionKey(account)).Result()
+}
+
+// RevokeAccountSessions 撤销账号所有的session（包括jwt的refresh token系列），可指定保留的session id，
+// 返回撤销的session数量
+func RevokeAccountSessions(ctx context.Context, account string, excludes ...string) (int, error) {
+	ids, err := ListAccountSessions(ctx, account)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, id := range ids {
+		if util.ContainsAny(excludes, id) {
+			continue
+		}
+		err = redisSession.Destroy(ctx, id)
+		if err != nil {
+			return count, err
+		}
+		// jwt模式的refresh token系列也记录在账号的session中
+		err = RemoveJWTFamily(ctx, id)
+		if err != nil {
+			return count, err
+		}
+		err = RemoveAccountSession(ctx, account, id)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
@@ -9,6 +9,9 @@ import (
 	lruttl "github.com/vicanso/lru-ttl"
 )
 
+// 缓存使用的redis client，测试时替换为miniredis
+var redisClient = helper.RedisGetClient()
+
 var redisCache = newRedisCache()
 var redisCacheWithCompress = newCompressRedisCache()
 var redisSession = newRedisSession()
@@ -16,7 +19,7 @@ var redisConfig = config.MustGetRedisConfig()
 
 // 常用的缓存库，支持几类常用的缓存函数
 func newRedisCache() *goCache.RedisCache {
-	c := goCache.NewRedisCache(helper.RedisGetClient())
+	c := goCache.NewRedisCache(redisClient)
 	return c
 }
 
@@ -26,14 +29,14 @@ func newCompressRedisCache() *goCache.RedisCache {
 	// 适用于数据量较大，而且数据内容重复较多的场景
 	minCompressSize := 10 * 1024
 	return goCache.NewCompressRedisCache(
-		helper.RedisGetClient(),
+		redisClient,
 		minCompressSize,
 	)
 }
 
 // redis session，用于elton session中间件
 func newRedisSession() *goCache.RedisSession {
-	ss := goCache.NewRedisSession(helper.RedisGetClient())
+	ss := goCache.NewRedisSession(redisClient)
 	// 设置前缀
 	ss.SetPrefix("ss:")
 	return ss
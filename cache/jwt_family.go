@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// refresh token轮换的结果
+const (
+	// JWTRotateSuccess 轮换成功
+	JWTRotateSuccess = 1
+	// JWTRotateNotFound 系列不存在（已过期或已撤销）
+	JWTRotateNotFound = 0
+	// JWTRotateReused 使用了已轮换的refresh token，系列已撤销
+	JWTRotateReused = -1
+)
+
+// 比较当前有效的refresh token id，一致则替换为新的id，
+// 不一致则表示旧的token被重复使用，删除整个系列
+var jwtRotateScript = redis.NewScript(`
+local current = redis.call("HGET", KEYS[1], "current")
+if not current then
+	return 0
+end
+if current ~= ARGV[1] then
+	redis.call("DEL", KEYS[1])
+	return -1
+end
+redis.call("HSET", KEYS[1], "current", ARGV[2])
+redis.call("PEXPIRE", KEYS[1], ARGV[3])
+return 1
+`)
+
+// jwt refresh token系列的key
+func getJWTFamilyKey(family string) string {
+	return "jwt:family:" + family
+}
+
+// AddJWTFamily 添加refresh token系列，记录当前有效的token id
+func AddJWTFamily(ctx context.Context, family, account, id string) error {
+	key := getJWTFamilyKey(family)
+	pipe := redisClient.TxPipeline()
+	pipe.HSet(ctx, key, "account", account, "current", id)
+	pipe.Expire(ctx, key, sessionConfig.JWTRefreshTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// RotateJWTFamily 轮换refresh token，返回JWTRotateSuccess、JWTRotateNotFound或JWTRotateReused
+func RotateJWTFamily(ctx context.Context, family, id, newID string) (int, error) {
+	result, err := jwtRotateScript.Run(
+		ctx,
+		redisClient,
+		[]string{getJWTFamilyKey(family)},
+		id,
+		newID,
+		sessionConfig.JWTRefreshTTL.Milliseconds(),
+	).Int()
+	if err != nil {
+		return 0, err
+	}
+	return result, nil
+}
+
+// RemoveJWTFamily 删除refresh token系列，该系列的refresh token均不可再使用
+func RemoveJWTFamily(ctx context.Context, family string) error {
+	return redisClient.Del(ctx, getJWTFamilyKey(family)).Err()
+}
@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/vicanso/beginner/config"
+	"github.com/vicanso/beginner/util"
+)
+
+var mailConfig = config.MustGetMailConfig()
+
+// 邮件token的key
+func getMailTokenKey(category, id string) string {
+	return "mail:token:" + category + ":" + id
+}
+
+// CreateMailToken 生成邮件使用的一次性token，格式为id.签名，
+// 对应的数据保存在redis中，有效期为配置的tokenTTL
+func CreateMailToken(ctx context.Context, category, value string) (string, error) {
+	id := util.GenXID()
+	err := redisClient.Set(ctx, getMailTokenKey(category, id), value, mailConfig.TokenTTL).Err()
+	if err != nil {
+		return "", err
+	}
+	return id + "." + util.HMACSign(mailConfig.TokenKey, category+":"+id), nil
+}
+
+// ConsumeMailToken 校验并使用邮件token，返回对应的数据，
+// token无效、已过期或已使用时返回空字符串
+func ConsumeMailToken(ctx context.Context, category, token string) (string, error) {
+	arr := strings.Split(token, ".")
+	if len(arr) != 2 {
+		return "", nil
+	}
+	id := arr[0]
+	// 签名不符合则不再查询redis
+	if !util.HMACVerify(mailConfig.TokenKey, category+":"+id, arr[1]) {
+		return "", nil
+	}
+	key := getMailTokenKey(category, id)
+	pipe := redisClient.TxPipeline()
+	getCmd := pipe.Get(ctx, key)
+	pipe.Del(ctx, key)
+	_, err := pipe.Exec(ctx)
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return getCmd.Val(), nil
+}
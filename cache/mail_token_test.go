@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/vicanso/beginner/internal/redistest"
+)
+
+func TestMailToken(t *testing.T) {
+	mr := redistest.Run(t, &redisClient)
+	ctx := context.Background()
+
+	token, err := CreateMailToken(ctx, "resetPassword", "tree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := strings.Split(token, ".")[0]
+	if mr.TTL(getMailTokenKey("resetPassword", id)) != mailConfig.TokenTTL {
+		t.Fatal("token should expire after token ttl")
+	}
+
+	// 其它分类或签名不符合的token无效，且不影响原token
+	for _, item := range []struct {
+		category string
+		token    string
+	}{
+		{
+			category: "verifyEmail",
+			token:    token,
+		},
+		{
+			category: "resetPassword",
+			token:    id + ".invalid",
+		},
+		{
+			category: "resetPassword",
+			token:    id,
+		},
+	} {
+		value, err := ConsumeMailToken(ctx, item.category, item.token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != "" {
+			t.Fatalf("token(%s) of %s should be invalid", item.token, item.category)
+		}
+	}
+
+	value, err := ConsumeMailToken(ctx, "resetPassword", token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "tree" {
+		t.Fatalf("unexpected token value: %s", value)
+	}
+	// 仅可使用一次
+	value, err = ConsumeMailToken(ctx, "resetPassword", token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "" {
+		t.Fatal("token should be consumed")
+	}
+}
+
+func TestMailTokenExpired(t *testing.T) {
+	mr := redistest.Run(t, &redisClient)
+	ctx := context.Background()
+
+	token, err := CreateMailToken(ctx, "verifyEmail", "tree@beginner.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr.FastForward(mailConfig.TokenTTL)
+	value, err := ConsumeMailToken(ctx, "verifyEmail", token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "" {
+		t.Fatal("token should be expired")
+	}
+}
@@ -0,0 +1,213 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/vicanso/beginner/log"
+	"github.com/vicanso/elton"
+)
+
+// SignedKey cookie的签名密钥
+type SignedKey struct {
+	Key       string    `json:"key"`
+	CreatedAt time.Time `json:"createdAt"`
+	// 过期时间，新的密钥生效后旧的密钥在此时间前仍可用于校验
+	ExpiredAt *time.Time `json:"expiredAt,omitempty"`
+}
+
+const (
+	// 签名密钥保存的key
+	signedKeysKey = "session:signedKeys"
+	// 签名密钥更新的通知channel
+	signedKeysChannel = "session:signedKeys"
+	// 定时移除过期密钥的间隔
+	signedKeysCheckInterval = time.Minute
+	// 更新密钥时因并发修改失败的最大重试次数
+	signedKeysRotateMaxRetries = 5
+)
+
+var (
+	// 当前使用的签名密钥，第一个用于签名，所有均可用于校验
+	signedKeys      = &elton.RWMutexSignedKeys{}
+	signedKeysMutex sync.Mutex
+	// 从redis中加载的密钥列表（包括过期时间）
+	signedKeyList  []*SignedKey
+	signedKeysOnce sync.Once
+)
+
+// GetSignedKeys 获取cookie签名使用的密钥
+func GetSignedKeys() elton.SignedKeysGenerator {
+	return signedKeys
+}
+
+// setSignedKeyList 设置密钥列表，仅未过期的密钥生效
+func setSignedKeyList(list []*SignedKey) {
+	signedKeysMutex.Lock()
+	defer signedKeysMutex.Unlock()
+	signedKeyList = list
+	now := time.Now()
+	keys := make([]string, 0, len(list))
+	for _, item := range list {
+		if item.ExpiredAt == nil || item.ExpiredAt.After(now) {
+			keys = append(keys, item.Key)
+		}
+	}
+	if len(keys) != 0 {
+		signedKeys.SetKeys(keys)
+	}
+}
+
+// ListSignedKeys 获取redis中保存的签名密钥
+func ListSignedKeys(ctx context.Context) ([]*SignedKey, error) {
+	return getSignedKeys(ctx, redisClient)
+}
+
+// getSignedKeys 获取签名密钥，事务中使用tx获取
+func getSignedKeys(ctx context.Context, cmdable redis.Cmdable) ([]*SignedKey, error) {
+	buf, err := cmdable.Get(ctx, signedKeysKey).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*SignedKey, 0)
+	err = json.Unmarshal(buf, &list)
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// LoadSignedKeys 从redis中加载签名密钥，若redis中无密钥则使用默认密钥初始化
+func LoadSignedKeys(ctx context.Context, defaultKeys []string) error {
+	list, err := ListSignedKeys(ctx)
+	if err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		now := time.Now()
+		list = make([]*SignedKey, len(defaultKeys))
+		for index, key := range defaultKeys {
+			list[index] = &SignedKey{
+				Key:       key,
+				CreatedAt: now,
+			}
+		}
+		// 仅在不存在时初始化，避免多实例同时启动时覆盖
+		buf, err := json.Marshal(list)
+		if err != nil {
+			return err
+		}
+		ok, err := redisClient.SetNX(ctx, signedKeysKey, buf, 0).Result()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return LoadSignedKeys(ctx, defaultKeys)
+		}
+	}
+	setSignedKeyList(list)
+	return nil
+}
+
+// RotateSignedKey 添加新的签名密钥，当前的密钥在grace时长内仍可用于校验，
+// 已过期的密钥则删除，返回更新后的密钥列表。
+// 使用WATCH保证读取与保存之间密钥未被修改，否则重新读取后再更新，避免并发更新时丢失密钥
+func RotateSignedKey(ctx context.Context, key string, grace time.Duration) ([]*SignedKey, error) {
+	var result []*SignedKey
+	fn := func(tx *redis.Tx) error {
+		list, err := getSignedKeys(ctx, tx)
+		if err != nil {
+			return err
+		}
+		result = rotateSignedKeyList(list, key, grace)
+		buf, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		// 保存并通知所有实例重新加载
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, signedKeysKey, buf, 0)
+			pipe.Publish(ctx, signedKeysChannel, time.Now().Unix())
+			return nil
+		})
+		return err
+	}
+	var err error
+	for i := 0; i < signedKeysRotateMaxRetries; i++ {
+		err = redisClient.Watch(ctx, fn, signedKeysKey)
+		if err != redis.TxFailedErr {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	setSignedKeyList(result)
+	return result, nil
+}
+
+// rotateSignedKeyList 生成添加新密钥后的列表，已过期的密钥删除，
+// 其它密钥的过期时间调整为不晚于grace时长后
+func rotateSignedKeyList(list []*SignedKey, key string, grace time.Duration) []*SignedKey {
+	now := time.Now()
+	expiredAt := now.Add(grace)
+	result := []*SignedKey{
+		{
+			Key:       key,
+			CreatedAt: now,
+		},
+	}
+	for _, item := range list {
+		if item.ExpiredAt != nil && !item.ExpiredAt.After(now) {
+			continue
+		}
+		// 未设置过期或过期时间晚于新的过期时间，则调整为新的过期时间
+		if item.ExpiredAt == nil || item.ExpiredAt.After(expiredAt) {
+			item.ExpiredAt = &expiredAt
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+// SubscribeSignedKeys 订阅签名密钥的更新，并定时移除已过期的密钥，仅首次调用生效
+func SubscribeSignedKeys() {
+	signedKeysOnce.Do(func() {
+		ctx := context.Background()
+		pubsub := redisClient.Subscribe(ctx, signedKeysChannel)
+		go func() {
+			// redis关闭时channel也关闭
+			for range pubsub.Channel() {
+				list, err := ListSignedKeys(ctx)
+				if err != nil {
+					log.Error(ctx).
+						Str("category", "loadSignedKeysFail").
+						Err(err).
+						Msg("")
+					continue
+				}
+				setSignedKeyList(list)
+				log.Info(ctx).
+					Str("category", "signedKeysUpdated").
+					Int("count", len(list)).
+					Msg("")
+			}
+		}()
+		go func() {
+			ticker := time.NewTicker(signedKeysCheckInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				signedKeysMutex.Lock()
+				list := signedKeyList
+				signedKeysMutex.Unlock()
+				setSignedKeyList(list)
+			}
+		}()
+	})
+}
@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vicanso/beginner/internal/redistest"
+)
+
+func TestRotateSignedKey(t *testing.T) {
+	redistest.Run(t, &redisClient)
+	ctx := context.Background()
+
+	err := LoadSignedKeys(ctx, []string{"key0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := RotateSignedKey(ctx, "key1", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Key != "key1" || list[0].ExpiredAt != nil {
+		t.Fatal("new key should be the first and never expire")
+	}
+	if list[1].Key != "key0" || list[1].ExpiredAt == nil {
+		t.Fatal("old key should expire after grace")
+	}
+
+	// 过期的密钥在更新时删除
+	list, err = RotateSignedKey(ctx, "key2", -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err = RotateSignedKey(ctx, "key3", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Key != "key3" || list[1].Key != "key2" {
+		t.Fatal("expired keys should be removed")
+	}
+}
+
+func TestRotateSignedKeyConcurrent(t *testing.T) {
+	redistest.Run(t, &redisClient)
+	ctx := context.Background()
+
+	err := LoadSignedKeys(ctx, []string{"key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 4
+	var wg sync.WaitGroup
+	errs := make(chan error, count)
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := RotateSignedKey(ctx, "key"+strconv.Itoa(i), time.Minute)
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 并发更新时不丢失任何密钥
+	list, err := ListSignedKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != count+1 {
+		t.Fatalf("should keep all keys, got %d", len(list))
+	}
+	keys := make(map[string]bool)
+	for _, item := range list {
+		keys[item.Key] = true
+	}
+	for i := 0; i < count; i++ {
+		if !keys["key"+strconv.Itoa(i)] {
+			t.Fatalf("key%d is lost", i)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/vicanso/beginner/util"
+)
+
+// SlidingWindow 基于redis sorted set的滑动窗口计数
+type SlidingWindow struct {
+	prefix string
+	window time.Duration
+}
+
+// NewSlidingWindow 创建滑动窗口计数
+func NewSlidingWindow(prefix string, window time.Duration) *SlidingWindow {
+	return &SlidingWindow{
+		prefix: prefix,
+		window: window,
+	}
+}
+
+func (sw *SlidingWindow) getKey(key string) string {
+	return sw.prefix + key
+}
+
+// 窗口的起始时间
+func (sw *SlidingWindow) getMin(now time.Time) string {
+	return strconv.FormatInt(now.Add(-sw.window).UnixNano(), 10)
+}
+
+// Add 增加一次计数，返回窗口内的总次数
+func (sw *SlidingWindow) Add(ctx context.Context, key string) (int64, error) {
+	key = sw.getKey(key)
+	now := time.Now()
+	pipe := redisClient.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, key, "0", sw.getMin(now))
+	pipe.ZAdd(ctx, key, &redis.Z{
+		Score:  float64(now.UnixNano()),
+		Member: util.GenXID(),
+	})
+	count := pipe.ZCard(ctx, key)
+	pipe.Expire(ctx, key, sw.window)
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return count.Val(), nil
+}
+
+// Count 获取窗口内的总次数
+func (sw *SlidingWindow) Count(ctx context.Context, key string) (int64, error) {
+	return redisClient.ZCount(
+		ctx,
+		sw.getKey(key),
+		sw.getMin(time.Now()),
+		"+inf",
+	).Result()
+}
+
+// Reset 清除计数
+func (sw *SlidingWindow) Reset(ctx context.Context, key string) error {
+	return redisClient.Del(ctx, sw.getKey(key)).Err()
+}
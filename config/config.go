@@ -3,6 +3,7 @@ package config
 import (
 	"bytes"
 	"embed"
+	"errors"
 	"io"
 	"net/url"
 	"os"
@@ -23,6 +24,8 @@ var (
 	env              = os.Getenv("GO_ENV")
 	defaultValidator = validator.New()
 	defaultViperX    = mustLoadConfig()
+	// 应用版本号，编译时通过ldflags设置
+	version = "unknown"
 )
 
 const (
@@ -41,12 +44,23 @@ type (
 		Listen string `validate:"required,ascii"`
 		// 最大处理请求数
 		RequestLimit uint `validate:"required"`
+		// 超出最大处理请求数时的等待时长，为0则直接拒绝
+		RequestLimitWait time.Duration
 		// 应用名称
 		Name string `validate:"required,ascii"`
 		// 应用前缀
 		Prefixes []string `validate:"omitempty"`
 		// 超时（用于设置所有请求)
 		Timeout time.Duration
+		// 依赖服务的检测间隔
+		HealthCheckInterval time.Duration
+		// 退出时设置readiness检测失败后，停止接收请求前的等待时长，
+		// 用于负载均衡检测到失败后不再转发请求
+		ShutdownDelay time.Duration
+		// 退出时等待处理中请求完成的最长时间
+		DrainTimeout time.Duration
+		// 退出时关闭各连接的超时
+		CloseTimeout time.Duration
 	}
 
 	// RedisConfig redis配置
@@ -59,12 +73,20 @@ type (
 		Password string
 		// 慢请求时长
 		Slow time.Duration `validate:"required"`
+		// 各命令的慢请求时长，命令名称为小写，未配置的命令使用Slow
+		SlowCommands map[string]time.Duration
 		// 最大的正在处理请求量
 		MaxProcessing uint32 `validate:"required"`
 		// 连接池大小
 		PoolSize int
 		// sentinel模式下使用的master name
 		Master string
+		// 熔断的出错比例，为0则不启用熔断
+		BreakerRatio float64 `validate:"min=0,max=1"`
+		// 熔断统计周期内的最少请求数，少于此值不熔断
+		BreakerMinRequests uint32
+		// 熔断后的冷却时长，之后允许试探请求
+		BreakerCoolDown time.Duration
 	}
 	// DatabaseConfig 数据库配置
 	DatabaseConfig struct {
@@ -78,6 +100,56 @@ type (
 		MaxIdleTime time.Duration `default:"5m"`
 	}
 
+	// LoginConfig 登录相关配置
+	LoginConfig struct {
+		// 登录失败次数统计的时间窗口
+		FailWindow time.Duration `validate:"required"`
+		// 时间窗口内账号的最大失败次数，超过则锁定账号
+		AccountMaxFail int `validate:"required,min=1"`
+		// 时间窗口内IP的最大失败次数，超过则禁止该IP登录
+		IPMaxFail int `validate:"required,min=1"`
+	}
+
+	// TOTPConfig 两步验证相关配置
+	TOTPConfig struct {
+		// 发行方，显示在验证器中
+		Issuer string `validate:"required"`
+		// 用于加密保存两步验证的密钥
+		Key string `validate:"required,min=8"`
+	}
+
+	// MailConfig 邮件相关配置
+	MailConfig struct {
+		// 发送方式，smtp、file（保存为文件）或log（输出至日志）
+		Transport string `validate:"required,oneof=smtp file log"`
+		// smtp服务地址
+		Host string `validate:"required_if=Transport smtp"`
+		// smtp服务端口
+		Port int `validate:"required_if=Transport smtp"`
+		// smtp用户名
+		Username string
+		// smtp密码
+		Password string
+		// 发件人
+		From string `validate:"required"`
+		// 保存邮件的目录，仅用于file方式
+		Dir string `validate:"required_if=Transport file"`
+		// 用于签名邮件中token的密钥
+		TokenKey string `validate:"required,min=8"`
+		// 邮件中token的有效期
+		TokenTTL time.Duration `validate:"required"`
+		// 邮箱验证的页面地址，token以query的形式添加
+		VerifyEmailURL string `validate:"required,url"`
+		// 重置密码的页面地址，token以query的形式添加
+		ResetPasswordURL string `validate:"required,url"`
+	}
+
+	// MetricsConfig 性能指标相关配置
+	MetricsConfig struct {
+		// prometheus获取指标的路由，为空则不启用
+		Path string `validate:"omitempty,startswith=/"`
+	}
+
 	// SessionConfig session相关配置信息
 	SessionConfig struct {
 		// cookie的保存路径
@@ -88,6 +160,14 @@ type (
 		TTL time.Duration `validate:"required"`
 		// 用于加密cookie的key
 		Keys []string `validate:"required"`
+		// jwt的签名算法，HS256或EdDSA
+		JWTAlgorithm string `validate:"required,oneof=HS256 EdDSA"`
+		// jwt的签名密钥，HS256为密钥字符串，EdDSA为base64后的ed25519私钥(seed)
+		JWTKey string `validate:"required,min=8"`
+		// access token的有效期
+		JWTAccessTTL time.Duration `validate:"required"`
+		// refresh token的有效期
+		JWTRefreshTTL time.Duration `validate:"required"`
 	}
 )
 
@@ -99,6 +179,11 @@ func GetENV() string {
 	return env
 }
 
+// GetVersion 获取应用版本号
+func GetVersion() string {
+	return version
+}
+
 // 对数据校验，如果出错则panic，仅用于初始化时的配置检查
 func mustValidate(v interface{}) {
 	err := defaultValidator.Struct(v)
@@ -140,11 +225,30 @@ func MustGetBasicConfig() *BasicConfig {
 	basicConfig := &BasicConfig{
 		Name:         defaultViperX.GetString(prefix + "name"),
 		RequestLimit: defaultViperX.GetUint(prefix + "requestLimit"),
+		// 超出并发限制时的等待时长
+		RequestLimitWait: defaultViperX.GetDuration(prefix + "requestLimitWait"),
 		// 端口优先读取env，若未指定则读取配置文件
 		Listen:   defaultViperX.GetStringFromENV(prefix + "listen"),
 		Prefixes: defaultViperX.GetStringSlice(prefix + "prefixes"),
 		// 超时优先读取env，若未指定则读取配置文件
 		Timeout: defaultViperX.GetDurationFromENV(prefix + "timeout"),
+		// 依赖服务检测间隔
+		HealthCheckInterval: defaultViperX.GetDuration(prefix + "healthCheckInterval"),
+		// 退出时停止接收请求前的等待时长
+		ShutdownDelay: defaultViperX.GetDuration(prefix + "shutdownDelay"),
+		// 退出时等待请求完成的时长
+		DrainTimeout: defaultViperX.GetDuration(prefix + "drainTimeout"),
+		// 退出时关闭连接的超时
+		CloseTimeout: defaultViperX.GetDuration(prefix + "closeTimeout"),
+	}
+	if basicConfig.HealthCheckInterval <= 0 {
+		basicConfig.HealthCheckInterval = 10 * time.Second
+	}
+	if basicConfig.DrainTimeout <= 0 {
+		basicConfig.DrainTimeout = 10 * time.Second
+	}
+	if basicConfig.CloseTimeout <= 0 {
+		basicConfig.CloseTimeout = 3 * time.Second
 	}
 	mustValidate(basicConfig)
 	return basicConfig
@@ -175,6 +279,23 @@ func MustGetRedisConfig() *RedisConfig {
 		}
 	}
 
+	// 获取各命令的慢请求配置，如slowCommands=blpop:5s,get:50ms
+	slowCommands := make(map[string]time.Duration)
+	for _, item := range strings.Split(query.Get("slowCommands"), ",") {
+		if item == "" {
+			continue
+		}
+		arr := strings.SplitN(item, ":", 2)
+		if len(arr) != 2 {
+			panic(errors.New("slowCommands is invalid: " + item))
+		}
+		d, err := time.ParseDuration(arr[1])
+		if err != nil {
+			panic(err)
+		}
+		slowCommands[strings.ToLower(arr[0])] = d
+	}
+
 	// 获取最大处理数的配置
 	maxProcessing := 1000
 	maxValue := query.Get("maxProcessing")
@@ -185,6 +306,34 @@ func MustGetRedisConfig() *RedisConfig {
 		}
 	}
 
+	// 熔断的出错比例
+	breakerRatio := 0.5
+	breakerRatioValue := query.Get("breakerRatio")
+	if breakerRatioValue != "" {
+		breakerRatio, err = strconv.ParseFloat(breakerRatioValue, 64)
+		if err != nil {
+			panic(err)
+		}
+	}
+	// 熔断的最少请求数
+	breakerMinRequests := 20
+	breakerMinRequestsValue := query.Get("breakerMinRequests")
+	if breakerMinRequestsValue != "" {
+		breakerMinRequests, err = strconv.Atoi(breakerMinRequestsValue)
+		if err != nil {
+			panic(err)
+		}
+	}
+	// 熔断的冷却时长
+	breakerCoolDown := 10 * time.Second
+	breakerCoolDownValue := query.Get("breakerCoolDown")
+	if breakerCoolDownValue != "" {
+		breakerCoolDown, err = time.ParseDuration(breakerCoolDownValue)
+		if err != nil {
+			panic(err)
+		}
+	}
+
 	// 转换失败则为0
 	// 连接池大小
 	poolSize, _ := strconv.Atoi(query.Get("poolSize"))
@@ -194,9 +343,14 @@ func MustGetRedisConfig() *RedisConfig {
 		Username:      username,
 		Password:      password,
 		Slow:          slow,
+		SlowCommands:  slowCommands,
 		MaxProcessing: uint32(maxProcessing),
 		PoolSize:      poolSize,
 		Master:        query.Get("master"),
+
+		BreakerRatio:       breakerRatio,
+		BreakerMinRequests: uint32(breakerMinRequests),
+		BreakerCoolDown:    breakerCoolDown,
 	}
 
 	mustValidate(redisConfig)
@@ -237,15 +391,98 @@ func MustGetDatabaseConfig() *DatabaseConfig {
 	return databaseConfig
 }
 
+const (
+	// 生产环境jwt密钥的env
+	sessionJWTKeyENV = "SESSION_JWT_KEY"
+	// 生产环境HS256密钥的最小长度
+	sessionJWTKeyMinSize = 32
+)
+
 // MustGetSessionConfig 获取session的配置
 func MustGetSessionConfig() *SessionConfig {
 	prefix := "session."
 	sessConfig := &SessionConfig{
-		TTL:        defaultViperX.GetDurationFromENV(prefix + "ttl"),
-		Key:        defaultViperX.GetStringFromENV(prefix + "key"),
-		CookiePath: defaultViperX.GetStringFromENV(prefix + "path"),
-		Keys:       defaultViperX.GetStringSliceFromENV(prefix + "keys"),
+		TTL:          defaultViperX.GetDurationFromENV(prefix + "ttl"),
+		Key:          defaultViperX.GetStringFromENV(prefix + "key"),
+		CookiePath:   defaultViperX.GetStringFromENV(prefix + "path"),
+		Keys:         defaultViperX.GetStringSliceFromENV(prefix + "keys"),
+		JWTAlgorithm: defaultViperX.GetString(prefix + "jwt.algorithm"),
+		// 密钥优先读取env
+		JWTKey:        defaultViperX.GetStringFromENV(prefix + "jwt.key"),
+		JWTAccessTTL:  defaultViperX.GetDuration(prefix + "jwt.accessTTL"),
+		JWTRefreshTTL: defaultViperX.GetDuration(prefix + "jwt.refreshTTL"),
 	}
 	mustValidate(sessConfig)
+	// 配置文件中的密钥为公开的，生产环境若使用则任何人均可伪造token，
+	// 因此仅从env读取，且HS256的密钥需足够长
+	if GetENV() == Production {
+		jwtKey := os.Getenv(sessionJWTKeyENV)
+		if jwtKey == "" || jwtKey == defaultViperX.GetString(prefix+"jwt.key") {
+			panic(errors.New("jwt key must be set by env " + sessionJWTKeyENV + " in production"))
+		}
+		if sessConfig.JWTAlgorithm == "HS256" && len(jwtKey) < sessionJWTKeyMinSize {
+			panic(errors.New("jwt key of HS256 is too short in production"))
+		}
+		sessConfig.JWTKey = jwtKey
+	}
 	return sessConfig
 }
+
+// MustGetLoginConfig 获取登录相关配置
+func MustGetLoginConfig() *LoginConfig {
+	prefix := "login."
+	loginConfig := &LoginConfig{
+		FailWindow:     defaultViperX.GetDuration(prefix + "failWindow"),
+		AccountMaxFail: defaultViperX.GetInt(prefix + "accountMaxFail"),
+		IPMaxFail:      defaultViperX.GetInt(prefix + "ipMaxFail"),
+	}
+	mustValidate(loginConfig)
+	return loginConfig
+}
+
+// MustGetTOTPConfig 获取两步验证的配置
+func MustGetTOTPConfig() *TOTPConfig {
+	prefix := "totp."
+	totpConfig := &TOTPConfig{
+		Issuer: defaultViperX.GetString(prefix + "issuer"),
+		// 密钥优先读取env
+		Key: defaultViperX.GetStringFromENV(prefix + "key"),
+	}
+	mustValidate(totpConfig)
+	return totpConfig
+}
+
+// MustGetMailConfig 获取邮件的配置
+func MustGetMailConfig() *MailConfig {
+	prefix := "mail."
+	mailConfig := &MailConfig{
+		Transport: defaultViperX.GetString(prefix + "transport"),
+		Host:      defaultViperX.GetString(prefix + "host"),
+		Port:      defaultViperX.GetInt(prefix + "port"),
+		Username:  defaultViperX.GetStringFromENV(prefix + "username"),
+		// 密码与密钥优先读取env
+		Password:         defaultViperX.GetStringFromENV(prefix + "password"),
+		From:             defaultViperX.GetString(prefix + "from"),
+		Dir:              defaultViperX.GetString(prefix + "dir"),
+		TokenKey:         defaultViperX.GetStringFromENV(prefix + "tokenKey"),
+		TokenTTL:         defaultViperX.GetDuration(prefix + "tokenTTL"),
+		VerifyEmailURL:   defaultViperX.GetString(prefix + "verifyEmailURL"),
+		ResetPasswordURL: defaultViperX.GetString(prefix + "resetPasswordURL"),
+	}
+	mustValidate(mailConfig)
+	// file与log方式会保存邮件全文（包括token），生产环境不允许使用
+	if GetENV() == Production && mailConfig.Transport != "smtp" {
+		panic(errors.New("mail transport must be smtp in production"))
+	}
+	return mailConfig
+}
+
+// MustGetMetricsConfig 获取性能指标的配置
+func MustGetMetricsConfig() *MetricsConfig {
+	prefix := "metrics."
+	metricsConfig := &MetricsConfig{
+		Path: defaultViperX.GetString(prefix + "path"),
+	}
+	mustValidate(metricsConfig)
+	return metricsConfig
+}
@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/vicanso/beginner/helper"
+	"github.com/vicanso/beginner/router"
+	"github.com/vicanso/elton"
+)
+
+// 健康检测，用于liveness与readiness
+type healthCtrl struct{}
+
+func init() {
+	ctrl := healthCtrl{}
+	g := router.NewGroup("")
+
+	// 程序是否存活，不检测依赖服务
+	g.GET("/ping", ctrl.ping)
+	// 程序是否可接收请求
+	g.GET("/health", ctrl.health)
+}
+
+func (*healthCtrl) ping(c *elton.Context) error {
+	c.NoCache()
+	c.Body = "pong"
+	return nil
+}
+
+func (*healthCtrl) health(c *elton.Context) error {
+	c.NoCache()
+	ready := helper.HealthIsReady()
+	if !ready {
+		c.StatusCode = http.StatusServiceUnavailable
+	}
+	c.Body = &struct {
+		Ready        bool                        `json:"ready"`
+		Closing      bool                        `json:"closing"`
+		Dependencies []*helper.HealthCheckResult `json:"dependencies"`
+	}{
+		Ready:        ready,
+		Closing:      helper.HealthIsClosing(),
+		Dependencies: helper.HealthGetResults(),
+	}
+	return nil
+}
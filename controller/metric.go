@@ -0,0 +1,37 @@
+package controller
+
+import (
+	"bytes"
+
+	"github.com/vicanso/beginner/config"
+	"github.com/vicanso/beginner/metric"
+	"github.com/vicanso/beginner/router"
+	"github.com/vicanso/elton"
+)
+
+// 性能指标，以prometheus的格式输出
+type metricCtrl struct{}
+
+func init() {
+	metricsConfig := config.MustGetMetricsConfig()
+	// 未配置则不启用
+	if metricsConfig.Path == "" {
+		return
+	}
+	ctrl := metricCtrl{}
+	g := router.NewGroup("")
+
+	g.GET(metricsConfig.Path, ctrl.metrics)
+}
+
+func (*metricCtrl) metrics(c *elton.Context) error {
+	buf := new(bytes.Buffer)
+	err := metric.WriteTo(buf)
+	if err != nil {
+		return err
+	}
+	c.NoCache()
+	c.SetHeader(elton.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	c.BodyBuffer = buf
+	return nil
+}
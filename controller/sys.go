@@ -0,0 +1,175 @@
+package controller
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"runtime"
+	"time"
+
+	"github.com/vicanso/beginner/cache"
+	"github.com/vicanso/beginner/config"
+	"github.com/vicanso/beginner/helper"
+	"github.com/vicanso/beginner/log"
+	M "github.com/vicanso/beginner/middleware"
+	"github.com/vicanso/beginner/router"
+	"github.com/vicanso/beginner/schema"
+	"github.com/vicanso/beginner/util"
+	"github.com/vicanso/beginner/validate"
+	"github.com/vicanso/elton"
+)
+
+// 系统相关功能，仅允许管理员访问
+type sysCtrl struct{}
+
+// 应用启动时间
+var applicationStartedAt = time.Now()
+
+var sessionConfig = config.MustGetSessionConfig()
+
+func init() {
+	ctrl := sysCtrl{}
+	g := router.NewGroup(
+		"/sys",
+		M.NewAPIToken(),
+		M.NewSession(),
+		// 账号设置至context，用于日志
+		M.NewSessionAccount(),
+		// 仅管理员可访问
+		M.NewCheckRoles(schema.UserRoleSu, schema.UserRoleAdmin),
+	)
+
+	// 系统运行状态统计
+	g.GET("/v1/stats", ctrl.stats)
+	// cookie签名密钥列表
+	g.GET("/v1/session-keys", ctrl.listSessionKeys)
+	// 更新cookie签名密钥（仅超级管理员）
+	g.POST(
+		"/v1/session-keys",
+		M.NewCheckRoles(schema.UserRoleSu),
+		ctrl.rotateSessionKey,
+	)
+}
+
+// 更新签名密钥参数
+type sysRotateSessionKeyParams struct {
+	// 新的密钥，为空则随机生成
+	Key string `json:"key" validate:"omitempty,xSessionKey"`
+	// 旧密钥可用于校验的时长，为空则为session的有效期
+	Grace string `json:"grace" validate:"omitempty,xDuration"`
+}
+
+// 签名密钥的展示信息，不返回完整的密钥
+type sysSessionKey struct {
+	Key       string     `json:"key"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiredAt *time.Time `json:"expiredAt,omitempty"`
+}
+
+// maskSessionKeys 隐藏密钥，仅展示前4个字符
+func maskSessionKeys(list []*cache.SignedKey) []*sysSessionKey {
+	result := make([]*sysSessionKey, len(list))
+	for index, item := range list {
+		key := item.Key
+		if len(key) > 4 {
+			key = key[:4]
+		}
+		result[index] = &sysSessionKey{
+			Key:       key + "***",
+			CreatedAt: item.CreatedAt,
+			ExpiredAt: item.ExpiredAt,
+		}
+	}
+	return result
+}
+
+func (*sysCtrl) listSessionKeys(c *elton.Context) error {
+	list, err := cache.ListSignedKeys(c.Context())
+	if err != nil {
+		return err
+	}
+	c.Body = &struct {
+		Keys []*sysSessionKey `json:"keys"`
+	}{
+		Keys: maskSessionKeys(list),
+	}
+	return nil
+}
+
+// rotateSessionKey 添加新的签名密钥，旧的密钥在grace时长内仍可校验，
+// 期间使用旧密钥签名的cookie在请求时重新签名
+func (*sysCtrl) rotateSessionKey(c *elton.Context) error {
+	params := sysRotateSessionKeyParams{}
+	err := validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return err
+	}
+	key := params.Key
+	if key == "" {
+		buf := make([]byte, 32)
+		_, err = rand.Read(buf)
+		if err != nil {
+			return err
+		}
+		key = base64.RawURLEncoding.EncodeToString(buf)
+	}
+	grace := sessionConfig.TTL
+	if params.Grace != "" {
+		grace, _ = time.ParseDuration(params.Grace)
+	}
+	u, err := M.GetLoginUser(c)
+	if err != nil {
+		return err
+	}
+	list, err := cache.RotateSignedKey(c.Context(), key, grace)
+	if err != nil {
+		return err
+	}
+	log.Info(c.Context()).
+		Str("category", "rotateSessionKey").
+		Str("account", u.Account).
+		Str("grace", grace.String()).
+		Msg("")
+	c.Body = &struct {
+		Keys []*sysSessionKey `json:"keys"`
+	}{
+		Keys: maskSessionKeys(list),
+	}
+	return nil
+}
+
+func (*sysCtrl) stats(c *elton.Context) error {
+	memStats := &runtime.MemStats{}
+	runtime.ReadMemStats(memStats)
+	var lastGC time.Time
+	if memStats.LastGC != 0 {
+		lastGC = time.Unix(0, int64(memStats.LastGC))
+	}
+	c.Body = map[string]interface{}{
+		"version":   config.GetVersion(),
+		"env":       config.GetENV(),
+		"startedAt": applicationStartedAt,
+		"uptime":    time.Since(applicationStartedAt).String(),
+		// 正在处理的http请求数
+		"processing": util.GetProcessing(),
+		"goroutine":  runtime.NumGoroutine(),
+		"memory": map[string]interface{}{
+			"alloc":      memStats.Alloc,
+			"totalAlloc": memStats.TotalAlloc,
+			"sys":        memStats.Sys,
+			"heapAlloc":  memStats.HeapAlloc,
+			"heapInuse":  memStats.HeapInuse,
+			"heapIdle":   memStats.HeapIdle,
+			"heapObjs":   memStats.HeapObjects,
+		},
+		"gc": map[string]interface{}{
+			"num":          memStats.NumGC,
+			"lastGC":       lastGC,
+			"pauseTotal":   time.Duration(memStats.PauseTotalNs).String(),
+			"cpuFraction":  memStats.GCCPUFraction,
+			"nextGCTarget": memStats.NextGC,
+		},
+		"redis":    helper.RedisStats(),
+		"database": helper.EntGetStats(),
+	}
+	return nil
+}
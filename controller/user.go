@@ -1,14 +1,27 @@
 package controller
 
 import (
-	"crypto/sha256"
-	"errors"
-	"fmt"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
 
+	"entgo.io/ent/dialect/sql"
+	"entgo.io/ent/dialect/sql/sqljson"
+	"github.com/spf13/cast"
+	"github.com/vicanso/beginner/cache"
+	"github.com/vicanso/beginner/config"
+	"github.com/vicanso/beginner/cs"
+	"github.com/vicanso/beginner/ent"
+	"github.com/vicanso/beginner/ent/predicate"
 	"github.com/vicanso/beginner/ent/user"
 	"github.com/vicanso/beginner/helper"
+	"github.com/vicanso/beginner/log"
 	M "github.com/vicanso/beginner/middleware"
 	"github.com/vicanso/beginner/router"
+	"github.com/vicanso/beginner/schema"
 	"github.com/vicanso/beginner/util"
 	"github.com/vicanso/beginner/validate"
 	"github.com/vicanso/elton"
@@ -29,7 +42,7 @@ type userRegisterParams struct {
 
 const (
 	sessionTokenKey   = "token"
-	sessionAccountKey = "account"
+	sessionAccountKey = cs.SessionAccountKey
 )
 
 // 登录参数
@@ -38,25 +51,192 @@ type userLoginParams struct {
 	Account string `json:"account" validate:"required,xUserAccount"`
 	// 密码
 	Password string `json:"password" validate:"required,xUserPassword"`
+	// 登录模式，cookie（默认）或jwt
+	Mode string `json:"mode" validate:"omitempty,xLoginMode"`
 }
 
+// 刷新jwt参数
+type userRefreshJWTParams struct {
+	RefreshToken string `json:"refreshToken" validate:"required,xJWT"`
+}
+
+// jwt登录模式，默认为cookie模式
+const loginModeJWT = "jwt"
+
+// 个人信息更新参数，仅更新有设置的字段
+type userUpdateMeParams struct {
+	// 用户名称
+	Name string `json:"name" validate:"omitempty,xUserName"`
+	// 用户邮箱
+	Email string `json:"email" validate:"omitempty,xUserEmail"`
+}
+
+// 修改密码参数
+type userChangePasswordParams struct {
+	// 当前密码
+	Password string `json:"password" validate:"required,xUserPassword"`
+	// 新密码
+	NewPassword string `json:"newPassword" validate:"required,xUserPassword,nefield=Password"`
+}
+
+// 用户查询参数
+type userListParams struct {
+	// 查询数量
+	Limit string `json:"limit" validate:"required,xLimit"`
+	// 偏移量
+	Offset string `json:"offset" validate:"omitempty,xOffset"`
+	// 上一页返回的游标（keyset分页），指定后offset无效
+	After string `json:"after" validate:"omitempty,base64url"`
+	// 排序字段，以-开头表示降序，默认为-id
+	Order string `json:"order" validate:"omitempty,xUserOrder"`
+	// 返回的字段，以,分隔
+	Fields string `json:"fields" validate:"omitempty,xUserFields"`
+	// 是否查询总数
+	Count string `json:"count" validate:"omitempty,xBool"`
+	// 状态
+	Status string `json:"status" validate:"omitempty,xStatus"`
+	// 角色，以,分隔
+	Roles string `json:"roles" validate:"omitempty,xUserRoles"`
+	// 分组，以,分隔
+	Groups string `json:"groups" validate:"omitempty,xUserGroups"`
+	// 账号前缀
+	Account string `json:"account" validate:"omitempty,xUserAccountKeyword"`
+	// 创建时间开始
+	CreatedAtStart string `json:"createdAtStart" validate:"omitempty,xDateTime"`
+	// 创建时间结束
+	CreatedAtEnd string `json:"createdAtEnd" validate:"omitempty,xDateTime"`
+}
+
+// 用户列表字段与数据库字段的对应
+var userListFields = map[string]string{
+	"id":            user.FieldID,
+	"account":       user.FieldAccount,
+	"name":          user.FieldName,
+	"roles":         user.FieldRoles,
+	"groups":        user.FieldGroups,
+	"email":         user.FieldEmail,
+	"emailVerified": user.FieldEmailVerified,
+	"status":        user.FieldStatus,
+	"createdAt":     user.FieldCreatedAt,
+	"updatedAt":     user.FieldUpdatedAt,
+}
+
+var errInvalidCursor = hes.New("游标无效", "validate")
+
+var errUpdateFieldsEmpty = hes.New("请指定需要更新的字段", "validate")
+
+var (
+	// 登录失败
+	errLoginFail = hes.New("用户名或密码错误", "login")
+	// 登录失败次数过多
+	errLoginTooManyFail = &hes.Error{
+		Message:    "登录失败次数过多，请稍候再试",
+		StatusCode: http.StatusTooManyRequests,
+		Category:   "login",
+	}
+)
+
+var loginConfig = config.MustGetLoginConfig()
+
+// 账号不存在时用于校验的hash，使账号不存在与密码错误的耗时一致，
+// 避免通过响应时长判断账号是否存在
+var dummyPasswordHash = mustNewDummyPasswordHash()
+
+func mustNewDummyPasswordHash() string {
+	hash, err := util.PasswordHash(util.GenXID())
+	if err != nil {
+		panic(err)
+	}
+	return hash
+}
+
+var (
+	// 账号登录失败次数统计
+	accountLoginFailWindow = cache.NewSlidingWindow("login:fail:account:", loginConfig.FailWindow)
+	// IP登录失败次数统计
+	ipLoginFailWindow = cache.NewSlidingWindow("login:fail:ip:", loginConfig.FailWindow)
+)
+
 func init() {
 	ctrl := userCtrl{}
 	g := router.NewGroup(
 		"/users",
 		// 添加当前组共用中间件
+		// API token与jwt认证需在session之前
+		M.NewAPIToken(),
+		M.NewJWT(),
 		M.NewSession(),
+		// 账号设置至context，用于日志
+		M.NewSessionAccount(),
 	)
 
 	// 当前登录信息查询
 	g.GET("/v1/me", ctrl.me)
 	// 注册用户
 	g.POST("/v1/me", ctrl.register)
+	// 退出登录
+	g.DELETE("/v1/me", ctrl.logout)
+	// 更新个人信息
+	g.PATCH("/v1/me", M.NewCheckLogin(), ctrl.updateMe)
+	// 修改密码
+	g.PUT("/v1/me/password", M.NewCheckLogin(), ctrl.changePassword)
+	// 发送邮箱验证邮件
+	g.POST("/v1/me/email-verification", M.NewCheckLogin(), ctrl.sendVerifyEmail)
+	// 验证邮箱
+	g.PUT("/v1/email-verification", ctrl.verifyEmail)
+	// 发送重置密码邮件
+	g.POST("/v1/password-reset", ctrl.sendResetPassword)
+	// 重置密码
+	g.PUT("/v1/password-reset", ctrl.resetPassword)
+
+	// 生成两步验证的密钥
+	g.POST("/v1/me/totp", M.NewCheckLogin(), ctrl.generateTOTP)
+	// 确认启用两步验证
+	g.PUT("/v1/me/totp", M.NewCheckLogin(), ctrl.enableTOTP)
+	// 关闭两步验证
+	g.DELETE("/v1/me/totp", M.NewCheckLogin(), ctrl.disableTOTP)
+	// 创建API token
+	g.POST("/v1/me/tokens", M.NewCheckLogin(), ctrl.createToken)
+	// 当前用户的API token
+	g.GET("/v1/me/tokens", M.NewCheckLogin(), ctrl.listToken)
+	// 撤销API token
+	g.DELETE("/v1/me/tokens/{id}", M.NewCheckLogin(), ctrl.revokeToken)
+	// 当前用户的登录记录
+	g.GET("/v1/me/logins", M.NewCheckLogin(), ctrl.listMyLogin)
+
+	// 用户列表查询（仅管理员）
+	g.GET(
+		"/v1",
+		M.NewCheckRoles(schema.UserRoleSu, schema.UserRoleAdmin),
+		ctrl.list,
+	)
+	// 登录记录查询（仅管理员）
+	g.GET(
+		"/v1/logins",
+		M.NewCheckRoles(schema.UserRoleSu, schema.UserRoleAdmin),
+		ctrl.listLogin,
+	)
+	// 更新用户的状态、角色与分组（仅管理员）
+	g.PATCH(
+		"/v1/{account}",
+		M.NewCheckRoles(schema.UserRoleSu, schema.UserRoleAdmin),
+		ctrl.update,
+	)
+	// 撤销账号所有的session（仅管理员）
+	g.DELETE(
+		"/v1/{account}/sessions",
+		M.NewCheckRoles(schema.UserRoleSu, schema.UserRoleAdmin),
+		ctrl.revokeSessions,
+	)
 
 	// 获取登录token
 	g.GET("/v1/login", ctrl.getLoginToken)
 	// 登录用户
 	g.POST("/v1/login", ctrl.login)
+	// 登录的两步验证
+	g.POST("/v1/login/totp", ctrl.loginTOTP)
+	// 刷新jwt
+	g.POST("/v1/jwt/refresh", ctrl.refreshJWT)
 }
 
 func (*userCtrl) me(c *elton.Context) error {
@@ -72,8 +252,8 @@ func (*userCtrl) me(c *elton.Context) error {
 
 func (*userCtrl) getLoginToken(c *elton.Context) error {
 	se := session.MustGet(c)
-	// 生成随机token
-	// 用于登录时用密码生成hash值
+	// 生成随机token，登录时需要session中存在token且仅可使用一次，
+	// token不参与密码校验（服务端保存argon2id，无法校验加盐后的值）
 	token := util.GenXID()
 	// 设置token至session中
 	err := se.Set(c.Context(), sessionTokenKey, token)
@@ -96,32 +276,454 @@ func (*userCtrl) login(c *elton.Context) error {
 		return err
 	}
 	se := session.MustGet(c)
+	token := se.GetString(sessionTokenKey)
+	if token == "" {
+		return hes.New("请先获取登录token")
+	}
+	// token仅允许使用一次
+	err = se.Set(c.Context(), sessionTokenKey, "")
+	if err != nil {
+		return err
+	}
+	// 登录失败次数过多则不再校验
+	err = checkLoginFail(c, params.Account)
+	if err != nil {
+		return err
+	}
 	user, err := helper.EntGetClient().User.Query().
 		Where(user.AccountEQ(params.Account)).
 		First(c.Context())
+	if ent.IsNotFound(err) {
+		// 账号不存在与密码错误返回相同的出错，且同样执行argon2id校验
+		_, _ = util.PasswordVerify(params.Password, dummyPasswordHash)
+		return loginFail(c, params.Account, "notFound")
+	}
 	if err != nil {
 		return err
 	}
-	// 数据库中保存的密码已经是sha256
-	token := se.GetString(sessionTokenKey)
-	pwd := fmt.Sprintf("%x", sha256.Sum256([]byte(user.Password+token)))
-	if params.Password != pwd {
-		// 不直接提示密码错
-		return hes.New("用户名或密码错误")
+	// 前端提交sha256(password)，服务端使用argon2id校验
+	matched, err := util.PasswordVerify(params.Password, user.Password)
+	if err != nil {
+		return err
+	}
+	if !matched {
+		return loginFail(c, params.Account, "passwordMismatch")
+	}
+	// 迁移生成的hash或hash参数已调整，则重新生成
+	if util.PasswordNeedsRehash(user.Password) {
+		rehashPassword(c.Context(), user.ID, params.Password)
+	}
+	err = checkLoginUserStatus(c, user)
+	if err != nil {
+		return err
+	}
+	// 已启用两步验证，则需要再校验验证码
+	if user.TotpSecret != "" {
+		err = se.SetMap(c.Context(), map[string]interface{}{
+			sessionPendingAccountKey: user.Account,
+			sessionPendingAtKey:      time.Now().Unix(),
+			sessionPendingModeKey:    params.Mode,
+		})
+		if err != nil {
+			return err
+		}
+		c.Body = &struct {
+			TOTPRequired bool `json:"totpRequired"`
+		}{
+			TOTPRequired: true,
+		}
+		return nil
+	}
+	return loginSuccess(c, user, params.Mode)
+}
+
+// loginSuccess 登录成功，cookie模式设置账号至session并返回用户信息，
+// jwt模式则返回用户信息与token
+func loginSuccess(c *elton.Context, u *ent.User, mode string) error {
+	se := session.MustGet(c)
+	// 登录成功则清除账号的失败次数
+	err := accountLoginFailWindow.Reset(c.Context(), u.Account)
+	if err != nil {
+		return err
+	}
+	if mode == loginModeJWT {
+		tokens, family, err := M.JWTIssue(c.Context(), u.Account)
+		if err != nil {
+			return err
+		}
+		addUserLogin(c, u.Account, family, true, "")
+		// ent.User有自定义的MarshalJSON，因此不能使用嵌入
+		c.Body = &struct {
+			User *ent.User `json:"user"`
+			*M.JWTTokens
+		}{
+			User:      u,
+			JWTTokens: tokens,
+		}
+		return nil
 	}
 	// 设置账号至session
-	err = se.Set(c.Context(), sessionAccountKey, params.Account)
+	err = se.Set(c.Context(), sessionAccountKey, u.Account)
 	if err != nil {
 		return err
 	}
+	// 记录账号对应的session，用于撤销账号所有session
+	// 登录前已获取token，因此session id已生成
+	err = cache.AddAccountSession(c.Context(), u.Account, se.ID)
+	if err != nil {
+		return err
+	}
+	addUserLogin(c, u.Account, se.ID, true, "")
 
 	// 成功返回用户信息
-	c.Body = user
+	c.Body = u
 	return nil
 }
 
+// checkLoginFail 校验账号与IP的登录失败次数是否超出限制
+func checkLoginFail(c *elton.Context, account string) error {
+	ctx := c.Context()
+	count, err := accountLoginFailWindow.Count(ctx, account)
+	if err != nil {
+		return err
+	}
+	reason := ""
+	if count >= int64(loginConfig.AccountMaxFail) {
+		reason = "accountLocked"
+	} else {
+		count, err = ipLoginFailWindow.Count(ctx, c.ClientIP())
+		if err != nil {
+			return err
+		}
+		if count >= int64(loginConfig.IPMaxFail) {
+			reason = "ipLimited"
+		}
+	}
+	if reason == "" {
+		return nil
+	}
+	log.Info(ctx).
+		Str("category", "loginFail").
+		Str("ip", c.ClientIP()).
+		Str("account", account).
+		Str("reason", reason).
+		Msg("")
+	addUserLogin(c, account, session.MustGet(c).ID, false, reason)
+	return errLoginTooManyFail.Clone()
+}
+
+// loginFail 记录登录失败次数，返回统一的登录失败出错
+func loginFail(c *elton.Context, account, reason string) error {
+	ctx := c.Context()
+	// RealIP取X-Forwarded-For的第一个IP，客户端可随意伪造，
+	// 因此使用从后往前的第一个公网IP（由前置代理添加）
+	ip := c.ClientIP()
+	accountCount, err := accountLoginFailWindow.Add(ctx, account)
+	if err != nil {
+		return err
+	}
+	ipCount, err := ipLoginFailWindow.Add(ctx, ip)
+	if err != nil {
+		return err
+	}
+	log.Info(ctx).
+		Str("category", "loginFail").
+		Str("ip", ip).
+		Str("account", account).
+		Str("reason", reason).
+		Int64("accountFailCount", accountCount).
+		Int64("ipFailCount", ipCount).
+		Msg("")
+	addUserLogin(c, account, session.MustGet(c).ID, false, reason)
+	// 不直接提示账号不存在或密码错
+	return errLoginFail.Clone()
+}
+
+// checkLoginUserStatus 校验通过后判断账号是否被禁用，被禁用则记录登录失败并返回出错，
+// 避免被禁用的账号获取session或jwt。在密码校验之后判断，因此不会泄露账号的状态
+func checkLoginUserStatus(c *elton.Context, u *ent.User) error {
+	if u.Status != schema.StatusDisabled {
+		return nil
+	}
+	log.Info(c.Context()).
+		Str("category", "loginDisabled").
+		Str("account", u.Account).
+		Msg("")
+	addUserLogin(c, u.Account, session.MustGet(c).ID, false, "disabled")
+	return M.ErrUserDisabled.Clone()
+}
+
+// rehashPassword 重新生成密码hash并保存，失败时仅输出日志不影响登录
+func rehashPassword(ctx context.Context, id int, password string) {
+	hash, err := util.PasswordHash(password)
+	if err == nil {
+		err = helper.EntGetClient().User.UpdateOneID(id).
+			SetPassword(hash).
+			Exec(ctx)
+	}
+	if err != nil {
+		log.Error(ctx).
+			Str("category", "rehashPasswordFail").
+			Err(err).
+			Msg("")
+	}
+}
+
+func (params *userListParams) where(q *ent.UserQuery) *ent.UserQuery {
+	if params.Status != "" {
+		q = q.Where(user.StatusEQ(schema.Status(cast.ToInt8(params.Status))))
+	}
+	if params.Account != "" {
+		q = q.Where(user.AccountHasPrefix(params.Account))
+	}
+	if params.CreatedAtStart != "" {
+		q = q.Where(user.CreatedAtGTE(cast.ToTime(params.CreatedAtStart)))
+	}
+	if params.CreatedAtEnd != "" {
+		q = q.Where(user.CreatedAtLTE(cast.ToTime(params.CreatedAtEnd)))
+	}
+	// 角色与分组满足其一即可
+	jsonContainsAny := func(column, values string) predicate.User {
+		return predicate.User(func(s *sql.Selector) {
+			preds := make([]*sql.Predicate, 0)
+			for _, value := range strings.Split(values, ",") {
+				preds = append(preds, sqljson.ValueContains(column, value))
+			}
+			s.Where(sql.Or(preds...))
+		})
+	}
+	if params.Roles != "" {
+		q = q.Where(jsonContainsAny(user.FieldRoles, params.Roles))
+	}
+	if params.Groups != "" {
+		q = q.Where(jsonContainsAny(user.FieldGroups, params.Groups))
+	}
+	return q
+}
+
+// getOrder 获取排序字段与是否降序，默认为-id
+func (params *userListParams) getOrder() (string, bool) {
+	order := params.Order
+	if order == "" {
+		order = "-id"
+	}
+	desc := strings.HasPrefix(order, "-")
+	return userListFields[strings.TrimPrefix(order, "-")], desc
+}
+
+// getFields 获取查询的字段，为空则查询所有字段
+func (params *userListParams) getFields() []string {
+	if params.Fields == "" {
+		return nil
+	}
+	column, _ := params.getOrder()
+	fields := []string{
+		// id与排序字段用于生成游标，必须查询
+		user.FieldID,
+		column,
+	}
+	for _, name := range strings.Split(params.Fields, ",") {
+		field := userListFields[name]
+		if !util.ContainsAny(fields, field) {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// userListCursor keyset分页的游标，记录上一页最后一条记录
+type userListCursor struct {
+	ID    int    `json:"id"`
+	Value string `json:"value"`
+}
+
+// newUserListCursor 根据排序字段生成游标
+func newUserListCursor(u *ent.User, column string) string {
+	cursor := userListCursor{
+		ID: u.ID,
+	}
+	switch column {
+	case user.FieldAccount:
+		cursor.Value = u.Account
+	case user.FieldCreatedAt:
+		cursor.Value = u.CreatedAt.Format(time.RFC3339Nano)
+	case user.FieldUpdatedAt:
+		cursor.Value = u.UpdatedAt.Format(time.RFC3339Nano)
+	}
+	buf, _ := json.Marshal(&cursor)
+	return base64.URLEncoding.EncodeToString(buf)
+}
+
+// afterCursor 获取游标之后的记录
+func (params *userListParams) afterCursor() (predicate.User, error) {
+	buf, err := base64.URLEncoding.DecodeString(params.After)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	cursor := userListCursor{}
+	err = json.Unmarshal(buf, &cursor)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	column, desc := params.getOrder()
+	var value interface{} = cursor.Value
+	switch column {
+	case user.FieldCreatedAt, user.FieldUpdatedAt:
+		value, err = time.Parse(time.RFC3339Nano, cursor.Value)
+		if err != nil {
+			return nil, errInvalidCursor
+		}
+	}
+	cmp := sql.GT
+	if desc {
+		cmp = sql.LT
+	}
+	return predicate.User(func(s *sql.Selector) {
+		idColumn := s.C(user.FieldID)
+		if column == user.FieldID {
+			s.Where(cmp(idColumn, cursor.ID))
+			return
+		}
+		col := s.C(column)
+		s.Where(sql.Or(
+			cmp(col, value),
+			sql.And(sql.EQ(col, value), cmp(idColumn, cursor.ID)),
+		))
+	}), nil
+}
+
+// pickUserFields 仅返回指定的字段
+func pickUserFields(users []*ent.User, fields string) ([]map[string]interface{}, error) {
+	keys := strings.Split(fields, ",")
+	// 状态则同时返回状态描述
+	if util.ContainsAny(keys, "status") {
+		keys = append(keys, "statusDesc")
+	}
+	result := make([]map[string]interface{}, len(users))
+	for index, u := range users {
+		buf, err := json.Marshal(u)
+		if err != nil {
+			return nil, err
+		}
+		data := make(map[string]interface{})
+		err = json.Unmarshal(buf, &data)
+		if err != nil {
+			return nil, err
+		}
+		item := make(map[string]interface{})
+		for _, key := range keys {
+			item[key] = data[key]
+		}
+		result[index] = item
+	}
+	return result, nil
+}
+
 func (*userCtrl) list(c *elton.Context) error {
-	return errors.New("仅允许管理员访问")
+	params := userListParams{}
+	err := validate.Do(&params, c.Query())
+	if err != nil {
+		return err
+	}
+	q := params.where(helper.EntGetClient().User.Query())
+
+	// 总数需在分页之前查询
+	count := -1
+	if params.Count == "true" || params.Count == "1" {
+		count, err = q.Clone().Count(c.Context())
+		if err != nil {
+			return err
+		}
+	}
+
+	limit := cast.ToInt(params.Limit)
+	column, desc := params.getOrder()
+	orderFn := ent.Asc
+	if desc {
+		orderFn = ent.Desc
+	}
+	q = q.Limit(limit).
+		Order(orderFn(column, user.FieldID))
+	if params.After != "" {
+		p, err := params.afterCursor()
+		if err != nil {
+			return err
+		}
+		q = q.Where(p)
+	} else if params.Offset != "" {
+		q = q.Offset(cast.ToInt(params.Offset))
+	}
+	fields := params.getFields()
+	if len(fields) != 0 {
+		q = q.Select(fields...).UserQuery
+	}
+	users, err := q.All(c.Context())
+	if err != nil {
+		return err
+	}
+
+	next := ""
+	// 如果数量与limit一致，则可能还有下一页
+	if len(users) == limit {
+		next = newUserListCursor(users[len(users)-1], column)
+	}
+	var data interface{} = users
+	if params.Fields != "" {
+		data, err = pickUserFields(users, params.Fields)
+		if err != nil {
+			return err
+		}
+	}
+	c.Body = &struct {
+		Users interface{} `json:"users"`
+		// 未指定查询总数时为-1
+		Count int `json:"count"`
+		// 下一页的游标
+		Next string `json:"next,omitempty"`
+	}{
+		Users: data,
+		Count: count,
+		Next:  next,
+	}
+	return nil
+}
+
+func (*userCtrl) logout(c *elton.Context) error {
+	// jwt模式则撤销refresh token
+	claims := M.GetJWTClaims(c)
+	if claims != nil {
+		err := M.JWTRevoke(c.Context(), claims)
+		if err != nil {
+			return err
+		}
+		c.NoContent()
+		return nil
+	}
+	err := M.DestroySession(c)
+	if err != nil {
+		return err
+	}
+	c.NoContent()
+	return nil
+}
+
+func (*userCtrl) revokeSessions(c *elton.Context) error {
+	account := c.Param("account")
+	count, err := cache.RevokeAccountSessions(c.Context(), account)
+	if err != nil {
+		return err
+	}
+	log.Info(c.Context()).
+		Str("category", "revokeSessions").
+		Str("target", account).
+		Int("count", count).
+		Msg("")
+	c.Body = &struct {
+		Count int `json:"count"`
+	}{
+		Count: count,
+	}
+	return nil
 }
 
 func (*userCtrl) register(c *elton.Context) error {
@@ -131,10 +733,14 @@ func (*userCtrl) register(c *elton.Context) error {
 		return err
 	}
 
+	// 密码前端使用sha256(password)处理，服务端再使用argon2id生成hash
+	hash, err := util.PasswordHash(params.Password)
+	if err != nil {
+		return err
+	}
 	user, err := helper.EntGetClient().User.Create().
 		SetAccount(params.Account).
-		// 密码前端使用sha256(password)处理
-		SetPassword(params.Password).
+		SetPassword(hash).
 		Save(c.Context())
 
 	if err != nil {
@@ -144,3 +750,107 @@ func (*userCtrl) register(c *elton.Context) error {
 	c.Created(user)
 	return nil
 }
+
+// updateMe 更新当前用户的个人信息
+func (*userCtrl) updateMe(c *elton.Context) error {
+	params := userUpdateMeParams{}
+	err := validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return err
+	}
+	if params.Name == "" && params.Email == "" {
+		return errUpdateFieldsEmpty.Clone()
+	}
+	u, err := M.GetLoginUser(c)
+	if err != nil {
+		return err
+	}
+	updateOne := helper.EntGetClient().User.UpdateOneID(u.ID)
+	if params.Name != "" {
+		updateOne = updateOne.SetName(params.Name)
+	}
+	// 邮箱修改后需要重新验证
+	if params.Email != "" && params.Email != u.Email {
+		updateOne = updateOne.SetEmail(params.Email).
+			SetEmailVerified(false)
+	}
+	user, err := updateOne.Save(c.Context())
+	if err != nil {
+		return err
+	}
+	M.RemoveUserCache(u.Account)
+	c.Body = user
+	return nil
+}
+
+// getCurrentSessionID 获取当前登录的session id，jwt模式则为refresh token的系列id，
+// api token访问时为空
+func getCurrentSessionID(c *elton.Context) string {
+	claims := M.GetJWTClaims(c)
+	if claims != nil {
+		return claims.Family
+	}
+	return session.MustGet(c).ID
+}
+
+// changePassword 修改当前用户的密码，成功后撤销该账号的其它session
+func (*userCtrl) changePassword(c *elton.Context) error {
+	params := userChangePasswordParams{}
+	err := validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return err
+	}
+	u, err := M.GetLoginUser(c)
+	if err != nil {
+		return err
+	}
+	// 与登录共用失败次数限制，避免session泄露后被暴力尝试密码
+	err = checkLoginFail(c, u.Account)
+	if err != nil {
+		return err
+	}
+	matched, err := util.PasswordVerify(params.Password, u.Password)
+	if err != nil {
+		return err
+	}
+	if !matched {
+		return loginFail(c, u.Account, "changePasswordMismatch")
+	}
+	hash, err := util.PasswordHash(params.NewPassword)
+	if err != nil {
+		return err
+	}
+	err = helper.EntGetClient().User.UpdateOneID(u.ID).
+		SetPassword(hash).
+		Exec(c.Context())
+	if err != nil {
+		return err
+	}
+	M.RemoveUserCache(u.Account)
+	count, err := cache.RevokeAccountSessions(c.Context(), u.Account, getCurrentSessionID(c))
+	if err != nil {
+		return err
+	}
+	log.Info(c.Context()).
+		Str("category", "changePassword").
+		Str("account", u.Account).
+		Int("revokedSessions", count).
+		Msg("")
+	c.NoContent()
+	return nil
+}
+
+// refreshJWT 使用refresh token获取新的token
+func (*userCtrl) refreshJWT(c *elton.Context) error {
+	params := userRefreshJWTParams{}
+	err := validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return err
+	}
+	tokens, err := M.JWTRefresh(c.Context(), params.RefreshToken)
+	if err != nil {
+		return err
+	}
+	c.Body = tokens
+	return nil
+}
@@ -0,0 +1,219 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+
+	"entgo.io/ent/dialect/sql"
+	"entgo.io/ent/dialect/sql/sqljson"
+	"github.com/vicanso/beginner/cache"
+	"github.com/vicanso/beginner/ent"
+	"github.com/vicanso/beginner/ent/predicate"
+	"github.com/vicanso/beginner/ent/user"
+	"github.com/vicanso/beginner/helper"
+	"github.com/vicanso/beginner/log"
+	M "github.com/vicanso/beginner/middleware"
+	"github.com/vicanso/beginner/schema"
+	"github.com/vicanso/beginner/util"
+	"github.com/vicanso/beginner/validate"
+	"github.com/vicanso/elton"
+	"github.com/vicanso/hes"
+)
+
+// 管理员更新用户参数，仅更新有设置的字段
+type userUpdateParams struct {
+	// 状态
+	Status schema.Status `json:"status" validate:"omitempty,xStatus"`
+	// 角色，设置为空数组则清除
+	Roles *[]string `json:"roles" validate:"omitempty,dive,xUserRole"`
+	// 分组，设置为空数组则清除
+	Groups *[]string `json:"groups" validate:"omitempty,dive,xUserGroup"`
+}
+
+// 用户的变更记录
+type userAuditRecord struct {
+	category string
+	before   interface{}
+	after    interface{}
+}
+
+var (
+	errUserUpdateFieldsEmpty = hes.New("请指定需要更新的字段", "validate")
+	errDisableSelf           = hes.New("不允许禁用自己的账号", "user")
+	errLastSu                = hes.New("不允许移除最后一个超级管理员", "user")
+	errGrantSu               = hes.New("仅超级管理员可调整超级管理员角色", "user")
+	errUpdateSu              = hes.New("仅超级管理员可修改超级管理员账号", "user")
+)
+
+// isEnabledSu 判断是否启用状态的超级管理员
+func isEnabledSu(roles []string, status schema.Status) bool {
+	return status == schema.StatusEnabled && util.ContainsAny(roles, schema.UserRoleSu)
+}
+
+// lockEnabledSu 锁定启用状态的超级管理员并返回数量，需在事务中调用，
+// 避免并发移除超级管理员时均判断为非最后一个（count不支持FOR UPDATE，因此查询id）
+func lockEnabledSu(ctx context.Context, client *ent.Client) (int, error) {
+	ids, err := client.User.Query().
+		Where(
+			user.StatusEQ(schema.StatusEnabled),
+			predicate.User(func(s *sql.Selector) {
+				s.Where(sqljson.ValueContains(user.FieldRoles, schema.UserRoleSu))
+			}),
+		).
+		// 按id顺序锁定，避免并发时死锁
+		Order(ent.Asc(user.FieldID)).
+		// postgres的FOR UPDATE不支持DISTINCT
+		Unique(false).
+		ForUpdate().
+		IDs(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// update 管理员更新用户的状态、角色与分组，每项变更均添加变更记录
+func (*userCtrl) update(c *elton.Context) error {
+	params := userUpdateParams{}
+	err := validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return err
+	}
+	if params.Status == 0 && params.Roles == nil && params.Groups == nil {
+		return errUserUpdateFieldsEmpty.Clone()
+	}
+	operator, err := M.GetLoginUser(c)
+	if err != nil {
+		return err
+	}
+	account := c.Param("account")
+	if params.Status == schema.StatusDisabled && account == operator.Account {
+		return errDisableSelf.Clone()
+	}
+
+	ctx := c.Context()
+	tx, err := helper.EntGetClient().Tx(ctx)
+	if err != nil {
+		return err
+	}
+	u, records, err := updateUserWithAudit(ctx, tx, c, operator, account, &params)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	M.RemoveUserCache(account)
+	// 禁用后撤销其所有的session
+	if params.Status == schema.StatusDisabled {
+		_, err = cache.RevokeAccountSessions(ctx, account)
+		if err != nil {
+			return err
+		}
+	}
+	for _, record := range records {
+		log.Info(ctx).
+			Str("category", "userAudit").
+			Str("operator", operator.Account).
+			Str("account", account).
+			Str("type", record.category).
+			Msg("")
+	}
+	c.Body = u
+	return nil
+}
+
+// updateUserWithAudit 在事务中更新用户并添加变更记录，返回更新后的用户与变更记录
+func updateUserWithAudit(ctx context.Context, tx *ent.Tx, c *elton.Context, operator *ent.User, account string, params *userUpdateParams) (*ent.User, []*userAuditRecord, error) {
+	client := tx.Client()
+	// 先锁定超级管理员再锁定用户，保证所有更新的加锁顺序一致，
+	// 并发的更新需等待前一事务完成后再校验
+	suCount, err := lockEnabledSu(ctx, client)
+	if err != nil {
+		return nil, nil, err
+	}
+	u, err := client.User.Query().
+		Where(user.AccountEQ(account)).
+		Unique(false).
+		ForUpdate().
+		Only(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	operatorIsSu := util.ContainsAny(operator.Roles, schema.UserRoleSu)
+	// 超级管理员账号仅允许超级管理员修改（包括状态与分组）
+	if util.ContainsAny(u.Roles, schema.UserRoleSu) && !operatorIsSu {
+		return nil, nil, errUpdateSu.Clone()
+	}
+
+	status := u.Status
+	roles := u.Roles
+	records := make([]*userAuditRecord, 0)
+	updateOne := client.User.UpdateOne(u)
+	if params.Status != 0 && params.Status != u.Status {
+		status = params.Status
+		updateOne = updateOne.SetStatus(status)
+		records = append(records, &userAuditRecord{
+			category: "status",
+			before:   u.Status,
+			after:    status,
+		})
+	}
+	if params.Roles != nil && !reflect.DeepEqual(*params.Roles, u.Roles) {
+		roles = *params.Roles
+		// 超级管理员角色仅允许超级管理员调整
+		if util.ContainsAny(roles, schema.UserRoleSu) && !operatorIsSu {
+			return nil, nil, errGrantSu.Clone()
+		}
+		updateOne = updateOne.SetRoles(roles)
+		records = append(records, &userAuditRecord{
+			category: "roles",
+			before:   u.Roles,
+			after:    roles,
+		})
+	}
+	if params.Groups != nil && !reflect.DeepEqual(*params.Groups, u.Groups) {
+		updateOne = updateOne.SetGroups(*params.Groups)
+		records = append(records, &userAuditRecord{
+			category: "groups",
+			before:   u.Groups,
+			after:    *params.Groups,
+		})
+	}
+	if len(records) == 0 {
+		return u, records, nil
+	}
+
+	// 移除角色或禁用超级管理员时，需保证至少还有一个超级管理员
+	if isEnabledSu(u.Roles, u.Status) && !isEnabledSu(roles, status) && suCount <= 1 {
+		return nil, nil, errLastSu.Clone()
+	}
+
+	u, err = updateOne.Save(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	bulk := make([]*ent.UserAuditCreate, len(records))
+	for index, record := range records {
+		before, _ := json.Marshal(record.before)
+		after, _ := json.Marshal(record.after)
+		bulk[index] = client.UserAudit.Create().
+			SetOperator(operator.Account).
+			SetAccount(account).
+			SetCategory(record.category).
+			SetBefore(string(before)).
+			SetAfter(string(after)).
+			// RealIP可被X-Forwarded-For伪造，因此使用ClientIP
+			SetIP(c.ClientIP()).
+			SetTraceID(util.GetTraceID(ctx))
+	}
+	_, err = client.UserAudit.CreateBulk(bulk...).Save(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return u, records, nil
+}
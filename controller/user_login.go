@@ -0,0 +1,188 @@
+package controller
+
+import (
+	"github.com/spf13/cast"
+	"github.com/vicanso/beginner/cache"
+	"github.com/vicanso/beginner/ent"
+	"github.com/vicanso/beginner/ent/userlogin"
+	"github.com/vicanso/beginner/helper"
+	"github.com/vicanso/beginner/log"
+	M "github.com/vicanso/beginner/middleware"
+	"github.com/vicanso/beginner/util"
+	"github.com/vicanso/beginner/validate"
+	"github.com/vicanso/elton"
+)
+
+// 当前用户登录记录查询参数
+type userMyLoginListParams struct {
+	// 查询数量
+	Limit string `json:"limit" validate:"required,xLimit"`
+	// 偏移量
+	Offset string `json:"offset" validate:"omitempty,xOffset"`
+}
+
+// 登录记录查询参数
+type userLoginListParams struct {
+	// 查询数量
+	Limit string `json:"limit" validate:"required,xLimit"`
+	// 偏移量
+	Offset string `json:"offset" validate:"omitempty,xOffset"`
+	// 是否查询总数
+	Count string `json:"count" validate:"omitempty,xBool"`
+	// 账号
+	Account string `json:"account" validate:"omitempty,xUserAccount"`
+	// 登录IP
+	IP string `json:"ip" validate:"omitempty,ip"`
+	// 是否登录成功
+	Success string `json:"success" validate:"omitempty,xBool"`
+	// 登录时间开始
+	CreatedAtStart string `json:"createdAtStart" validate:"omitempty,xDateTime"`
+	// 登录时间结束
+	CreatedAtEnd string `json:"createdAtEnd" validate:"omitempty,xDateTime"`
+}
+
+// 登录记录，附带session是否仍有效
+type userLoginRecord struct {
+	*ent.UserLogin
+	// session是否仍有效
+	Active bool `json:"active"`
+	// 是否当前session
+	Current bool `json:"current"`
+}
+
+// addUserLogin 添加登录记录，sessionID为cookie的session id或jwt的系列id，
+// 失败时仅输出日志不影响登录
+func addUserLogin(c *elton.Context, account, sessionID string, success bool, reason string) {
+	ctx := c.Context()
+	err := helper.EntGetClient().UserLogin.Create().
+		SetAccount(account).
+		// 与登录失败次数限制一致使用ClientIP，RealIP取X-Forwarded-For的第一个IP，可被伪造
+		SetIP(c.ClientIP()).
+		SetUserAgent(c.GetRequestHeader("User-Agent")).
+		SetSessionID(sessionID).
+		SetTraceID(util.GetTraceID(ctx)).
+		SetSuccess(success).
+		SetReason(reason).
+		Exec(ctx)
+	if err != nil {
+		log.Error(ctx).
+			Str("category", "addUserLoginFail").
+			Str("account", account).
+			Err(err).
+			Msg("")
+	}
+}
+
+// newUserLoginRecords 生成登录记录，session id不返回，由服务端判断是否仍有效或当前session
+func newUserLoginRecords(c *elton.Context, logins []*ent.UserLogin) ([]*userLoginRecord, error) {
+	// 每个账号仅查询一次有效的session
+	accountSessions := make(map[string][]string)
+	for _, item := range logins {
+		if _, ok := accountSessions[item.Account]; ok || !item.Success {
+			continue
+		}
+		sessions, err := cache.ListAccountSessions(c.Context(), item.Account)
+		if err != nil {
+			return nil, err
+		}
+		accountSessions[item.Account] = sessions
+	}
+	currentID := getCurrentSessionID(c)
+	records := make([]*userLoginRecord, len(logins))
+	for index, item := range logins {
+		records[index] = &userLoginRecord{
+			UserLogin: item,
+			Active:    item.Success && util.ContainsAny(accountSessions[item.Account], item.SessionID),
+			Current:   item.Success && currentID != "" && item.SessionID == currentID,
+		}
+	}
+	return records, nil
+}
+
+func (params *userLoginListParams) where(q *ent.UserLoginQuery) *ent.UserLoginQuery {
+	if params.Account != "" {
+		q = q.Where(userlogin.AccountEQ(params.Account))
+	}
+	if params.IP != "" {
+		q = q.Where(userlogin.IPEQ(params.IP))
+	}
+	if params.Success != "" {
+		q = q.Where(userlogin.SuccessEQ(cast.ToBool(params.Success)))
+	}
+	if params.CreatedAtStart != "" {
+		q = q.Where(userlogin.CreatedAtGTE(cast.ToTime(params.CreatedAtStart)))
+	}
+	if params.CreatedAtEnd != "" {
+		q = q.Where(userlogin.CreatedAtLTE(cast.ToTime(params.CreatedAtEnd)))
+	}
+	return q
+}
+
+// listMyLogin 查询当前用户的登录记录，并标记session是否仍有效
+func (*userCtrl) listMyLogin(c *elton.Context) error {
+	params := userMyLoginListParams{}
+	err := validate.Do(&params, c.Query())
+	if err != nil {
+		return err
+	}
+	u, err := M.GetLoginUser(c)
+	if err != nil {
+		return err
+	}
+	logins, err := helper.EntGetClient().UserLogin.Query().
+		Where(userlogin.AccountEQ(u.Account)).
+		Limit(cast.ToInt(params.Limit)).
+		Offset(cast.ToInt(params.Offset)).
+		Order(ent.Desc(userlogin.FieldID)).
+		All(c.Context())
+	if err != nil {
+		return err
+	}
+	records, err := newUserLoginRecords(c, logins)
+	if err != nil {
+		return err
+	}
+	c.Body = &struct {
+		Logins []*userLoginRecord `json:"logins"`
+	}{
+		Logins: records,
+	}
+	return nil
+}
+
+// listLogin 查询登录记录（仅管理员）
+func (*userCtrl) listLogin(c *elton.Context) error {
+	params := userLoginListParams{}
+	err := validate.Do(&params, c.Query())
+	if err != nil {
+		return err
+	}
+	q := params.where(helper.EntGetClient().UserLogin.Query())
+	count := -1
+	if params.Count == "true" || params.Count == "1" {
+		count, err = q.Clone().Count(c.Context())
+		if err != nil {
+			return err
+		}
+	}
+	logins, err := q.Limit(cast.ToInt(params.Limit)).
+		Offset(cast.ToInt(params.Offset)).
+		Order(ent.Desc(userlogin.FieldID)).
+		All(c.Context())
+	if err != nil {
+		return err
+	}
+	records, err := newUserLoginRecords(c, logins)
+	if err != nil {
+		return err
+	}
+	c.Body = &struct {
+		Logins []*userLoginRecord `json:"logins"`
+		// 未指定查询总数时为-1
+		Count int `json:"count"`
+	}{
+		Logins: records,
+		Count:  count,
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/vicanso/beginner/cache"
+	"github.com/vicanso/beginner/config"
+	"github.com/vicanso/beginner/ent"
+	"github.com/vicanso/beginner/ent/user"
+	"github.com/vicanso/beginner/helper"
+	"github.com/vicanso/beginner/log"
+	"github.com/vicanso/beginner/mail"
+	M "github.com/vicanso/beginner/middleware"
+	"github.com/vicanso/beginner/util"
+	"github.com/vicanso/beginner/validate"
+	"github.com/vicanso/elton"
+	"github.com/vicanso/hes"
+)
+
+// 邮件token的数据
+type userMailTokenData struct {
+	Account string `json:"account"`
+	// 验证的邮箱，邮箱修改后则token无效
+	Email string `json:"email,omitempty"`
+}
+
+// 邮箱验证参数
+type userVerifyEmailParams struct {
+	Token string `json:"token" validate:"required,xMailToken"`
+}
+
+// 申请重置密码参数
+type userSendResetPasswordParams struct {
+	Account string `json:"account" validate:"required,xUserAccount"`
+}
+
+// 重置密码参数
+type userResetPasswordParams struct {
+	Token string `json:"token" validate:"required,xMailToken"`
+	// 新密码
+	Password string `json:"password" validate:"required,xUserPassword"`
+}
+
+const (
+	// 邮件token的类别
+	mailTokenVerifyEmail   = "verifyEmail"
+	mailTokenResetPassword = "resetPassword"
+
+	// 同一账号发送邮件的间隔
+	mailSendInterval = time.Minute
+)
+
+var mailConfig = config.MustGetMailConfig()
+
+var (
+	errEmailEmpty          = hes.New("请先设置邮箱", "mail")
+	errEmailVerified       = hes.New("邮箱已验证", "mail")
+	errMailTokenInvalid    = hes.New("链接无效或已过期", "mail")
+	errMailSendTooFrequent = &hes.Error{
+		Message:    "发送过于频繁，请稍候再试",
+		StatusCode: http.StatusTooManyRequests,
+		Category:   "mail",
+	}
+)
+
+// sendUserMail 生成token并发送邮件，同一账号同类邮件发送需间隔mailSendInterval
+func sendUserMail(c *elton.Context, category, templateName, pageURL, to string, data *userMailTokenData) error {
+	ctx := c.Context()
+	ok, err := helper.RedisGetClient().SetNX(ctx, "mail:interval:"+category+":"+data.Account, 1, mailSendInterval).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errMailSendTooFrequent.Clone()
+	}
+	buf, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	token, err := cache.CreateMailToken(ctx, category, string(buf))
+	if err != nil {
+		return err
+	}
+	return mail.SendTemplate(ctx, to, templateName, &struct {
+		Account string
+		URL     string
+		TTL     time.Duration
+	}{
+		Account: data.Account,
+		URL:     pageURL + "?token=" + url.QueryEscape(token),
+		TTL:     mailConfig.TokenTTL,
+	})
+}
+
+// consumeUserMailToken 使用邮件token，返回对应的数据
+func consumeUserMailToken(c *elton.Context, category, token string) (*userMailTokenData, error) {
+	value, err := cache.ConsumeMailToken(c.Context(), category, token)
+	if err != nil {
+		return nil, err
+	}
+	if value == "" {
+		return nil, errMailTokenInvalid.Clone()
+	}
+	data := &userMailTokenData{}
+	err = json.Unmarshal([]byte(value), data)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// sendVerifyEmail 发送邮箱验证的邮件
+func (*userCtrl) sendVerifyEmail(c *elton.Context) error {
+	u, err := M.GetLoginUser(c)
+	if err != nil {
+		return err
+	}
+	if u.Email == "" {
+		return errEmailEmpty.Clone()
+	}
+	if u.EmailVerified {
+		return errEmailVerified.Clone()
+	}
+	err = sendUserMail(c, mailTokenVerifyEmail, mail.TemplateVerifyEmail, mailConfig.VerifyEmailURL, u.Email, &userMailTokenData{
+		Account: u.Account,
+		Email:   u.Email,
+	})
+	if err != nil {
+		return err
+	}
+	c.NoContent()
+	return nil
+}
+
+// verifyEmail 通过邮件中的token验证邮箱，无需登录
+func (*userCtrl) verifyEmail(c *elton.Context) error {
+	params := userVerifyEmailParams{}
+	err := validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return err
+	}
+	data, err := consumeUserMailToken(c, mailTokenVerifyEmail, params.Token)
+	if err != nil {
+		return err
+	}
+	// 邮箱需与发送时一致
+	count, err := helper.EntGetClient().User.Update().
+		Where(
+			user.AccountEQ(data.Account),
+			user.EmailEQ(data.Email),
+		).
+		SetEmailVerified(true).
+		Save(c.Context())
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return errMailTokenInvalid.Clone()
+	}
+	M.RemoveUserCache(data.Account)
+	c.NoContent()
+	return nil
+}
+
+// sendResetPassword 发送重置密码的邮件，仅发送至已验证的邮箱，
+// 为避免泄露账号信息，账号不存在或邮箱未验证均返回成功
+func (*userCtrl) sendResetPassword(c *elton.Context) error {
+	params := userSendResetPasswordParams{}
+	err := validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return err
+	}
+	u, err := helper.EntGetClient().User.Query().
+		Where(user.AccountEQ(params.Account)).
+		Only(c.Context())
+	if err != nil && !ent.IsNotFound(err) {
+		return err
+	}
+	if u != nil && u.EmailVerified && u.Email != "" {
+		err = sendUserMail(c, mailTokenResetPassword, mail.TemplateResetPassword, mailConfig.ResetPasswordURL, u.Email, &userMailTokenData{
+			Account: u.Account,
+		})
+		// 发送失败仅输出日志
+		if err != nil {
+			log.Error(c.Context()).
+				Str("category", "sendResetPasswordFail").
+				Str("account", u.Account).
+				Err(err).
+				Msg("")
+		}
+	}
+	c.NoContent()
+	return nil
+}
+
+// resetPassword 通过邮件中的token重置密码，成功后撤销该账号所有的session
+func (*userCtrl) resetPassword(c *elton.Context) error {
+	params := userResetPasswordParams{}
+	err := validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return err
+	}
+	data, err := consumeUserMailToken(c, mailTokenResetPassword, params.Token)
+	if err != nil {
+		return err
+	}
+	hash, err := util.PasswordHash(params.Password)
+	if err != nil {
+		return err
+	}
+	ctx := c.Context()
+	count, err := helper.EntGetClient().User.Update().
+		Where(user.AccountEQ(data.Account)).
+		SetPassword(hash).
+		Save(ctx)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return errMailTokenInvalid.Clone()
+	}
+	M.RemoveUserCache(data.Account)
+	// 重置后允许立即登录
+	err = accountLoginFailWindow.Reset(ctx, data.Account)
+	if err != nil {
+		return err
+	}
+	revoked, err := cache.RevokeAccountSessions(ctx, data.Account)
+	if err != nil {
+		return err
+	}
+	log.Info(ctx).
+		Str("category", "resetPassword").
+		Str("account", data.Account).
+		Int("revokedSessions", revoked).
+		Msg("")
+	c.NoContent()
+	return nil
+}
@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/spf13/cast"
+	"github.com/vicanso/beginner/ent"
+	"github.com/vicanso/beginner/ent/apitoken"
+	"github.com/vicanso/beginner/helper"
+	M "github.com/vicanso/beginner/middleware"
+	"github.com/vicanso/beginner/util"
+	"github.com/vicanso/beginner/validate"
+	"github.com/vicanso/elton"
+	"github.com/vicanso/hes"
+)
+
+// 创建API token参数
+type userCreateTokenParams struct {
+	// 名称
+	Name string `json:"name" validate:"required,xAPITokenName"`
+	// 权限范围
+	Scopes []string `json:"scopes" validate:"required,min=1,dive,xAPITokenScope"`
+	// 过期时间，为空则不过期
+	ExpiredAt string `json:"expiredAt" validate:"omitempty,xDateTime"`
+}
+
+// 保存的API token前缀长度（bgn_及随后的6个字符）
+const apiTokenPrefixSize = 10
+
+var (
+	errTokenCreateByToken = hes.New("不允许使用token创建token", "apiToken")
+	errTokenExpiredAt     = hes.New("过期时间需晚于当前时间", "apiToken")
+	errTokenNotFound      = hes.New("token不存在", "apiToken")
+)
+
+// createToken 创建API token，原始token仅在创建时返回
+func (*userCtrl) createToken(c *elton.Context) error {
+	params := userCreateTokenParams{}
+	err := validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return err
+	}
+	// 避免token泄露后被用于生成新的token
+	if M.GetAPIToken(c) != nil {
+		return errTokenCreateByToken.Clone()
+	}
+	u, err := M.GetLoginUser(c)
+	if err != nil {
+		return err
+	}
+	token, err := util.APITokenGenerate()
+	if err != nil {
+		return err
+	}
+	create := helper.EntGetClient().APIToken.Create().
+		SetAccount(u.Account).
+		SetName(params.Name).
+		SetTokenHash(util.APITokenHash(token)).
+		SetPrefix(token[:apiTokenPrefixSize]).
+		SetScopes(params.Scopes)
+	if params.ExpiredAt != "" {
+		expiredAt := cast.ToTime(params.ExpiredAt)
+		if expiredAt.Before(time.Now()) {
+			return errTokenExpiredAt.Clone()
+		}
+		create = create.SetExpiredAt(expiredAt)
+	}
+	result, err := create.Save(c.Context())
+	if err != nil {
+		return err
+	}
+	c.Created(&struct {
+		*ent.APIToken
+		// 原始token，仅返回一次
+		Token string `json:"token"`
+	}{
+		APIToken: result,
+		Token:    token,
+	})
+	return nil
+}
+
+// listToken 查询当前用户的API token
+func (*userCtrl) listToken(c *elton.Context) error {
+	u, err := M.GetLoginUser(c)
+	if err != nil {
+		return err
+	}
+	tokens, err := helper.EntGetClient().APIToken.Query().
+		Where(apitoken.AccountEQ(u.Account)).
+		Order(ent.Desc(apitoken.FieldID)).
+		All(c.Context())
+	if err != nil {
+		return err
+	}
+	c.Body = &struct {
+		Tokens []*ent.APIToken `json:"tokens"`
+	}{
+		Tokens: tokens,
+	}
+	return nil
+}
+
+// revokeToken 撤销当前用户的API token
+func (*userCtrl) revokeToken(c *elton.Context) error {
+	u, err := M.GetLoginUser(c)
+	if err != nil {
+		return err
+	}
+	id := cast.ToInt(c.Param("id"))
+	revoked, err := revokeAPIToken(c.Context(), helper.EntGetClient(), u.Account, id)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return errTokenNotFound.Clone()
+	}
+	c.NoContent()
+	return nil
+}
+
+// revokeAPIToken 撤销用户的API token，删除操作被hook禁止，因此设置撤销时间，
+// token不存在或已撤销时返回false
+func revokeAPIToken(ctx context.Context, client *ent.Client, account string, id int) (bool, error) {
+	count, err := client.APIToken.Update().
+		Where(
+			apitoken.ID(id),
+			apitoken.AccountEQ(account),
+			apitoken.RevokedAtIsNil(),
+		).
+		SetRevokedAt(time.Now()).
+		Save(ctx)
+	if err != nil {
+		return false, err
+	}
+	return count != 0, nil
+}
@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"entgo.io/ent/dialect"
+	entsql "entgo.io/ent/dialect/sql"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/vicanso/beginner/ent"
+	"github.com/vicanso/beginner/helper"
+	"github.com/vicanso/beginner/schema"
+)
+
+// newTestEntClient 使用sqlite内存数据库创建client，hooks与默认client一致
+func newTestEntClient(t *testing.T) *ent.Client {
+	driver, err := entsql.Open(dialect.SQLite, "file:"+t.Name()+"?mode=memory&cache=shared&_fk=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := helper.EntNewClient(driver)
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	err = client.Schema.Create(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestRevokeAPIToken(t *testing.T) {
+	client := newTestEntClient(t)
+	ctx := context.Background()
+
+	token, err := client.APIToken.Create().
+		SetAccount("tree").
+		SetName("ci").
+		SetTokenHash("hash").
+		SetPrefix("bgn_abcdef").
+		SetScopes([]string{schema.APITokenScopeRead}).
+		Save(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 删除操作被hook禁止，因此撤销不能使用删除
+	err = client.APIToken.DeleteOneID(token.ID).Exec(ctx)
+	if err == nil {
+		t.Fatal("delete should be rejected by hook")
+	}
+
+	// 其它账号不可撤销
+	revoked, err := revokeAPIToken(ctx, client, "other", token.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked {
+		t.Fatal("should not revoke token of other account")
+	}
+
+	revoked, err = revokeAPIToken(ctx, client, "tree", token.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !revoked {
+		t.Fatal("should revoke token")
+	}
+	token, err = client.APIToken.Get(ctx, token.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.RevokedAt == nil {
+		t.Fatal("revoked at should be set")
+	}
+
+	// 已撤销的token再次撤销则为不存在
+	revoked, err = revokeAPIToken(ctx, client, "tree", token.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked {
+		t.Fatal("revoked token should not be revoked again")
+	}
+}
@@ -0,0 +1,292 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/vicanso/beginner/config"
+	"github.com/vicanso/beginner/ent"
+	"github.com/vicanso/beginner/ent/user"
+	"github.com/vicanso/beginner/helper"
+	M "github.com/vicanso/beginner/middleware"
+	"github.com/vicanso/beginner/util"
+	"github.com/vicanso/beginner/validate"
+	"github.com/vicanso/elton"
+	session "github.com/vicanso/elton-session"
+	"github.com/vicanso/hes"
+)
+
+// 两步验证的参数
+type userTOTPParams struct {
+	// 验证器的验证码或恢复码
+	Code string `json:"code" validate:"required,xUserTOTPCode"`
+}
+
+const (
+	// 密码校验通过，等待两步验证的账号
+	sessionPendingAccountKey = "pendingAccount"
+	// 密码校验通过的时间
+	sessionPendingAtKey = "pendingAt"
+	// 登录模式
+	sessionPendingModeKey = "pendingMode"
+
+	// 等待两步验证的有效期
+	totpPendingTTL = 5 * time.Minute
+	// 生成的密钥在确认启用前的有效期
+	totpSecretTTL = 10 * time.Minute
+	// 恢复码的数量
+	totpRecoveryCodeCount = 10
+)
+
+var totpConfig = config.MustGetTOTPConfig()
+
+var (
+	errTOTPNotEnabled     = hes.New("未启用两步验证", "totp")
+	errTOTPAlreadyEnabled = hes.New("已启用两步验证", "totp")
+	errTOTPNotGenerated   = hes.New("请先生成两步验证的密钥", "totp")
+	errTOTPCodeInvalid    = hes.New("验证码错误", "totp")
+	errTOTPPendingExpired = hes.New("两步验证已过期，请重新登录", "totp")
+	errTOTPByToken        = hes.New("不允许使用token设置两步验证", "totp")
+)
+
+// getTOTPSecretKey 生成的密钥在确认前保存的key，
+// jwt与API token认证时session为只读，因此不保存在session中
+func getTOTPSecretKey(account string) string {
+	return "totp:secret:" + account
+}
+
+// generateTOTP 生成两步验证的密钥，确认前加密保存在redis中
+func (*userCtrl) generateTOTP(c *elton.Context) error {
+	// 避免token泄露后被用于绑定他人的验证器
+	if M.GetAPIToken(c) != nil {
+		return errTOTPByToken.Clone()
+	}
+	u, err := M.GetLoginUser(c)
+	if err != nil {
+		return err
+	}
+	if u.TotpSecret != "" {
+		return errTOTPAlreadyEnabled.Clone()
+	}
+	secret, err := util.TOTPGenerateSecret()
+	if err != nil {
+		return err
+	}
+	encrypted, err := util.AESEncrypt(totpConfig.Key, secret)
+	if err != nil {
+		return err
+	}
+	err = helper.RedisGetClient().Set(c.Context(), getTOTPSecretKey(u.Account), encrypted, totpSecretTTL).Err()
+	if err != nil {
+		return err
+	}
+	c.Body = &struct {
+		Secret string `json:"secret"`
+		// 用于生成二维码
+		URI string `json:"uri"`
+	}{
+		Secret: secret,
+		URI:    util.TOTPGetURI(totpConfig.Issuer, u.Account, secret),
+	}
+	return nil
+}
+
+// enableTOTP 校验验证码后启用两步验证，返回恢复码（仅返回一次）
+func (*userCtrl) enableTOTP(c *elton.Context) error {
+	params := userTOTPParams{}
+	err := validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return err
+	}
+	if M.GetAPIToken(c) != nil {
+		return errTOTPByToken.Clone()
+	}
+	u, err := M.GetLoginUser(c)
+	if err != nil {
+		return err
+	}
+	if u.TotpSecret != "" {
+		return errTOTPAlreadyEnabled.Clone()
+	}
+	secretKey := getTOTPSecretKey(u.Account)
+	encrypted, err := helper.RedisGetClient().Get(c.Context(), secretKey).Result()
+	if helper.RedisIsNilError(err) {
+		return errTOTPNotGenerated.Clone()
+	}
+	if err != nil {
+		return err
+	}
+	secret, err := util.AESDecrypt(totpConfig.Key, encrypted)
+	if err != nil {
+		return err
+	}
+	_, ok := util.TOTPValidate(secret, params.Code, time.Now())
+	if !ok {
+		return errTOTPCodeInvalid.Clone()
+	}
+	codes, err := util.TOTPGenerateRecoveryCodes(totpRecoveryCodeCount)
+	if err != nil {
+		return err
+	}
+	hashes := make([]string, len(codes))
+	for index, code := range codes {
+		hashes[index] = util.TOTPHashRecoveryCode(code)
+	}
+	err = helper.EntGetClient().User.UpdateOneID(u.ID).
+		SetTotpSecret(encrypted).
+		SetTotpRecoveryCodes(hashes).
+		Exec(c.Context())
+	if err != nil {
+		return err
+	}
+	M.RemoveUserCache(u.Account)
+	err = helper.RedisGetClient().Del(c.Context(), secretKey).Err()
+	if err != nil {
+		return err
+	}
+	c.Body = &struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}{
+		RecoveryCodes: codes,
+	}
+	return nil
+}
+
+// disableTOTP 校验验证码后关闭两步验证
+func (*userCtrl) disableTOTP(c *elton.Context) error {
+	params := userTOTPParams{}
+	err := validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return err
+	}
+	u, err := M.GetLoginUser(c)
+	if err != nil {
+		return err
+	}
+	if u.TotpSecret == "" {
+		return errTOTPNotEnabled.Clone()
+	}
+	ok, err := verifyTOTPCode(c.Context(), u, params.Code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errTOTPCodeInvalid.Clone()
+	}
+	err = helper.EntGetClient().User.UpdateOneID(u.ID).
+		ClearTotpSecret().
+		ClearTotpRecoveryCodes().
+		Exec(c.Context())
+	if err != nil {
+		return err
+	}
+	M.RemoveUserCache(u.Account)
+	c.NoContent()
+	return nil
+}
+
+// loginTOTP 密码校验通过后的两步验证
+func (*userCtrl) loginTOTP(c *elton.Context) error {
+	params := userTOTPParams{}
+	err := validate.Do(&params, c.RequestBody)
+	if err != nil {
+		return err
+	}
+	se := session.MustGet(c)
+	account := se.GetString(sessionPendingAccountKey)
+	mode := se.GetString(sessionPendingModeKey)
+	pendingAt := time.Unix(int64(se.GetInt(sessionPendingAtKey)), 0)
+	if account == "" || time.Since(pendingAt) > totpPendingTTL {
+		return errTOTPPendingExpired.Clone()
+	}
+	err = checkLoginFail(c, account)
+	if err != nil {
+		return err
+	}
+	u, err := helper.EntGetClient().User.Query().
+		Where(user.AccountEQ(account)).
+		Only(c.Context())
+	if err != nil {
+		return err
+	}
+	ok, err := verifyTOTPCode(c.Context(), u, params.Code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return loginFail(c, account, "totpMismatch")
+	}
+	// 等待验证码期间账号可能已被禁用
+	err = checkLoginUserStatus(c, u)
+	if err != nil {
+		return err
+	}
+	err = se.SetMap(c.Context(), map[string]interface{}{
+		sessionPendingAccountKey: nil,
+		sessionPendingAtKey:      nil,
+		sessionPendingModeKey:    nil,
+	})
+	if err != nil {
+		return err
+	}
+	return loginSuccess(c, u, mode)
+}
+
+// verifyTOTPCode 校验验证器的验证码或恢复码，恢复码使用后则删除
+func verifyTOTPCode(ctx context.Context, u *ent.User, code string) (bool, error) {
+	secret, err := util.AESDecrypt(totpConfig.Key, u.TotpSecret)
+	if err != nil {
+		return false, err
+	}
+	step, ok := util.TOTPValidate(secret, code, time.Now())
+	if ok {
+		// 同一验证码仅允许使用一次
+		key := fmt.Sprintf("totp:used:%s:%d", u.Account, step)
+		return helper.RedisGetClient().SetNX(ctx, key, 1, totpPendingTTL).Result()
+	}
+	return consumeTOTPRecoveryCode(ctx, u.ID, util.TOTPHashRecoveryCode(code))
+}
+
+// consumeTOTPRecoveryCode 使用恢复码，存在则删除并返回true。
+// 在事务中锁定用户后再删除，避免并发时同一恢复码多次使用成功
+func consumeTOTPRecoveryCode(ctx context.Context, id int, hash string) (bool, error) {
+	tx, err := helper.EntGetClient().Tx(ctx)
+	if err != nil {
+		return false, err
+	}
+	u, err := tx.User.Query().
+		Where(user.ID(id)).
+		Unique(false).
+		ForUpdate().
+		Only(ctx)
+	if err != nil {
+		_ = tx.Rollback()
+		return false, err
+	}
+	codes := make([]string, 0, len(u.TotpRecoveryCodes))
+	found := false
+	for _, item := range u.TotpRecoveryCodes {
+		if item == hash {
+			found = true
+			continue
+		}
+		codes = append(codes, item)
+	}
+	if !found {
+		_ = tx.Rollback()
+		return false, nil
+	}
+	err = tx.User.UpdateOneID(id).
+		SetTotpRecoveryCodes(codes).
+		Exec(ctx)
+	if err != nil {
+		_ = tx.Rollback()
+		return false, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
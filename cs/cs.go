@@ -10,4 +10,9 @@ const (
 )
 
 // ***处理
-var MaskRegExp = regexp.MustCompile(`(?i)password`)
+var MaskRegExp = regexp.MustCompile(`(?i)password|totp_`)
+
+const (
+	// SessionAccountKey session中保存账号的key
+	SessionAccountKey = "account"
+)
@@ -4,10 +4,12 @@ go 1.17
 
 require (
 	entgo.io/ent v0.10.1
+	github.com/alicebob/miniredis/v2 v2.31.1
 	github.com/dustin/go-humanize v1.0.0
 	github.com/go-playground/validator/v10 v10.10.1
 	github.com/go-redis/redis/v8 v8.11.5
 	github.com/jackc/pgx/v4 v4.15.0
+	github.com/mattn/go-sqlite3 v1.14.10
 	github.com/mcuadros/go-defaults v1.2.0
 	github.com/rs/xid v1.4.0
 	github.com/rs/zerolog v1.26.1
@@ -20,11 +22,13 @@ require (
 	github.com/vicanso/lru-ttl v1.4.0
 	github.com/vicanso/viperx v0.6.0
 	go.uber.org/atomic v1.9.0
+	golang.org/x/crypto v0.0.0-20220331220935-ae2d96664a29
 )
 
 require (
 	ariga.io/atlas v0.3.7 // indirect
 	github.com/agext/levenshtein v1.2.3 // indirect
+	github.com/alicebob/gopher-json v0.0.0-20200520072559-a9ecdc9d1d3a // indirect
 	github.com/andybalholm/brotli v1.0.4 // indirect
 	github.com/apparentlymart/go-textseg/v13 v13.0.0 // indirect
 	github.com/cespare/xxhash/v2 v2.1.2 // indirect
@@ -63,8 +67,8 @@ require (
 	github.com/tidwall/pretty v1.2.0 // indirect
 	github.com/vicanso/intranet-ip v0.1.0 // indirect
 	github.com/vicanso/keygrip v1.2.1 // indirect
+	github.com/yuin/gopher-lua v1.1.0 // indirect
 	github.com/zclconf/go-cty v1.10.0 // indirect
-	golang.org/x/crypto v0.0.0-20220331220935-ae2d96664a29 // indirect
 	golang.org/x/mod v0.5.1 // indirect
 	golang.org/x/sys v0.0.0-20220403020550-483a9cbc67c0 // indirect
 	golang.org/x/text v0.3.7 // indirect
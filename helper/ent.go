@@ -19,7 +19,9 @@ import (
 	"github.com/vicanso/beginner/cs"
 	"github.com/vicanso/beginner/ent"
 	"github.com/vicanso/beginner/ent/hook"
+	"github.com/vicanso/beginner/ent/user"
 	"github.com/vicanso/beginner/log"
+	"github.com/vicanso/beginner/metric"
 	"github.com/vicanso/beginner/util"
 	"github.com/vicanso/hes"
 	"go.uber.org/atomic"
@@ -31,6 +33,16 @@ var (
 var databaseConfig = config.MustGetDatabaseConfig()
 var (
 	initSchemaOnce sync.Once
+
+	// 数据库更新操作耗时分布
+	entMutationDuration = metric.NewHistogramVec(
+		"ent_mutation_duration_seconds",
+		"Latency of ent mutations",
+		nil,
+		"schema",
+		"op",
+		"result",
+	)
 )
 
 func getMaskURI(uri string) string {
@@ -102,11 +114,15 @@ func mustNewEntClient() (*entsql.Driver, *ent.Client) {
 
 	// Create an ent.Driver from `db`.
 	driver := entsql.OpenDB(driverType, db)
+	return driver, EntNewClient(driver)
+}
+
+// EntNewClient 根据driver创建client，并添加与默认client一致的hooks（如禁止删除）
+func EntNewClient(driver dialect.Driver) *ent.Client {
 	entLogger := log.NewEntLogger()
 	c := ent.NewClient(ent.Driver(driver), ent.Log(entLogger.Log))
-
 	initSchemaHooks(c)
-	return driver, c
+	return c
 }
 
 // initSchemaHooks 初始化相关的hooks
@@ -173,6 +189,11 @@ func initSchemaHooks(c *ent.Client) {
 			}
 
 			d := time.Since(startedAt)
+			resultLabel := "success"
+			if result == cs.ResultFail {
+				resultLabel = "fail"
+			}
+			entMutationDuration.Observe(d.Seconds(), schemaType, op, resultLabel)
 			log.Info(ctx).
 				Str("category", "entStats").
 				Str("schema", schemaType).
@@ -203,6 +224,43 @@ func EntInitSchema() (err error) {
 	return
 }
 
+// EntMigrateLegacyPassword 将旧的密码保存方式(前端的sha256)迁移为argon2id，
+// 迁移后不再保存原始的sha256，已迁移的则忽略，因此可每次启动时执行
+func EntMigrateLegacyPassword(ctx context.Context) error {
+	client := defaultEntClient
+	users, err := client.User.Query().
+		Where(user.Not(user.PasswordHasPrefix("$"))).
+		Select(user.FieldID, user.FieldPassword).
+		All(ctx)
+	if err != nil {
+		return err
+	}
+	for _, u := range users {
+		hash, err := util.PasswordWrapLegacy(u.Password)
+		if err != nil {
+			return err
+		}
+		// 仅在密码未被修改时更新
+		err = client.User.Update().
+			Where(
+				user.ID(u.ID),
+				user.PasswordEQ(u.Password),
+			).
+			SetPassword(hash).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	if len(users) != 0 {
+		log.Info(ctx).
+			Str("category", "migrateLegacyPassword").
+			Int("count", len(users)).
+			Msg("")
+	}
+	return nil
+}
+
 // EntGetStats get ent stats
 func EntGetStats() map[string]interface{} {
 	info := defaultEntDriver.DB().Stats()
@@ -224,3 +282,8 @@ func EntGetStats() map[string]interface{} {
 func EntGetClient() *ent.Client {
 	return defaultEntClient
 }
+
+// EntClose 关闭数据库连接
+func EntClose() error {
+	return defaultEntClient.Close()
+}
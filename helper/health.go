@@ -0,0 +1,127 @@
+package helper
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/vicanso/beginner/log"
+	"go.uber.org/atomic"
+)
+
+type (
+	// HealthCheckResult 依赖服务的检测结果
+	HealthCheckResult struct {
+		// 服务名称
+		Name string `json:"name"`
+		// 是否正常
+		Healthy bool `json:"healthy"`
+		// 检测耗时
+		Latency string `json:"latency"`
+		// 出错信息
+		Message string `json:"message,omitempty"`
+		// 检测时间
+		CheckedAt time.Time `json:"checkedAt"`
+	}
+	// healthChecker 依赖服务的检测
+	healthChecker struct {
+		name string
+		fn   func() error
+	}
+)
+
+var (
+	healthCheckers = []healthChecker{
+		{
+			name: "redis",
+			fn:   RedisPing,
+		},
+		{
+			name: "database",
+			fn:   EntPing,
+		},
+	}
+	healthMutex   sync.RWMutex
+	healthResults []*HealthCheckResult
+	// 程序是否关闭中
+	healthClosing = atomic.NewBool(false)
+	healthOnce    sync.Once
+)
+
+// HealthCheck 检测所有依赖服务，并缓存检测结果
+func HealthCheck() []*HealthCheckResult {
+	results := make([]*HealthCheckResult, len(healthCheckers))
+	for index, checker := range healthCheckers {
+		startedAt := time.Now()
+		err := checker.fn()
+		result := &HealthCheckResult{
+			Name:      checker.name,
+			Healthy:   err == nil,
+			Latency:   time.Since(startedAt).String(),
+			CheckedAt: startedAt,
+		}
+		if err != nil {
+			result.Message = err.Error()
+			log.Error(context.Background()).
+				Str("category", "healthCheckFail").
+				Str("name", checker.name).
+				Err(err).
+				Msg("")
+		}
+		results[index] = result
+	}
+	healthMutex.Lock()
+	defer healthMutex.Unlock()
+	healthResults = results
+	return results
+}
+
+// HealthStartCheck 定时检测依赖服务，仅首次调用生效
+func HealthStartCheck(interval time.Duration) {
+	healthOnce.Do(func() {
+		HealthCheck()
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for range ticker.C {
+				HealthCheck()
+			}
+		}()
+	})
+}
+
+// HealthGetResults 获取最近一次的检测结果
+func HealthGetResults() []*HealthCheckResult {
+	healthMutex.RLock()
+	defer healthMutex.RUnlock()
+	return healthResults
+}
+
+// HealthIsReady 判断程序是否可接收请求，
+// 程序关闭中或有依赖服务异常均认为未就绪
+func HealthIsReady() bool {
+	if healthClosing.Load() {
+		return false
+	}
+	results := HealthGetResults()
+	// 未检测过
+	if len(results) == 0 {
+		return false
+	}
+	for _, result := range results {
+		if !result.Healthy {
+			return false
+		}
+	}
+	return true
+}
+
+// HealthSetClosing 设置程序关闭中，readiness检测则失败
+func HealthSetClosing() {
+	healthClosing.Store(true)
+}
+
+// HealthIsClosing 判断程序是否关闭中
+func HealthIsClosing() bool {
+	return healthClosing.Load()
+}
@@ -0,0 +1,102 @@
+package helper
+
+import (
+	"github.com/go-redis/redis/v8"
+	"github.com/vicanso/beginner/metric"
+)
+
+func init() {
+	// 连接池的相关统计，在获取指标时才读取
+	redisPoolStats := func(fn func(*redis.PoolStats) uint32) func() float64 {
+		return func() float64 {
+			return float64(fn(RedisGetClient().PoolStats()))
+		}
+	}
+	metric.NewGaugeFunc(
+		"redis_pool_total_conns",
+		"Number of total connections in the redis pool",
+		redisPoolStats(func(ps *redis.PoolStats) uint32 {
+			return ps.TotalConns
+		}),
+	)
+	metric.NewGaugeFunc(
+		"redis_pool_idle_conns",
+		"Number of idle connections in the redis pool",
+		redisPoolStats(func(ps *redis.PoolStats) uint32 {
+			return ps.IdleConns
+		}),
+	)
+	metric.NewCounterFunc(
+		"redis_pool_hits_total",
+		"Number of times free connection was found in the redis pool",
+		redisPoolStats(func(ps *redis.PoolStats) uint32 {
+			return ps.Hits
+		}),
+	)
+	metric.NewCounterFunc(
+		"redis_pool_misses_total",
+		"Number of times free connection was not found in the redis pool",
+		redisPoolStats(func(ps *redis.PoolStats) uint32 {
+			return ps.Misses
+		}),
+	)
+	metric.NewCounterFunc(
+		"redis_pool_timeouts_total",
+		"Number of times a wait timeout occurred in the redis pool",
+		redisPoolStats(func(ps *redis.PoolStats) uint32 {
+			return ps.Timeouts
+		}),
+	)
+	metric.NewGaugeFunc(
+		"redis_processing",
+		"Number of processing redis commands",
+		func() float64 {
+			processing, pipeProcessing, _ := defaultRedisHook.getProcessingAndTotal()
+			return float64(processing + pipeProcessing)
+		},
+	)
+
+	// 数据库连接池的相关统计
+	metric.NewGaugeFunc(
+		"db_pool_max_open_conns",
+		"Maximum number of open connections to the database",
+		func() float64 {
+			return float64(defaultEntDriver.DB().Stats().MaxOpenConnections)
+		},
+	)
+	metric.NewGaugeFunc(
+		"db_pool_open_conns",
+		"Number of established connections to the database",
+		func() float64 {
+			return float64(defaultEntDriver.DB().Stats().OpenConnections)
+		},
+	)
+	metric.NewGaugeFunc(
+		"db_pool_in_use_conns",
+		"Number of database connections currently in use",
+		func() float64 {
+			return float64(defaultEntDriver.DB().Stats().InUse)
+		},
+	)
+	metric.NewGaugeFunc(
+		"db_pool_idle_conns",
+		"Number of idle database connections",
+		func() float64 {
+			return float64(defaultEntDriver.DB().Stats().Idle)
+		},
+	)
+	metric.NewCounterFunc(
+		"db_pool_wait_total",
+		"Total number of database connections waited for",
+		func() float64 {
+			return float64(defaultEntDriver.DB().Stats().WaitCount)
+		},
+	)
+	metric.NewCounterFunc(
+		"db_pool_wait_seconds_total",
+		"Total time blocked waiting for a new database connection",
+		func() float64 {
+			return defaultEntDriver.DB().Stats().WaitDuration.Seconds()
+		},
+	)
+}
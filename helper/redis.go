@@ -9,6 +9,7 @@ import (
 	"github.com/go-redis/redis/v8"
 	"github.com/vicanso/beginner/config"
 	"github.com/vicanso/beginner/log"
+	"github.com/vicanso/beginner/metric"
 	"github.com/vicanso/hes"
 	"go.uber.org/atomic"
 )
@@ -22,24 +23,58 @@ var (
 		StatusCode: http.StatusInternalServerError,
 		Category:   "redis",
 	}
+
+	// redis命令耗时分布
+	redisCmdDuration = metric.NewHistogramVec(
+		"redis_command_duration_seconds",
+		"Latency of redis commands",
+		nil,
+		"cmd",
+	)
+	// redis命令出错次数
+	redisCmdErrors = metric.NewCounterVec(
+		"redis_command_errors_total",
+		"Count of redis command errors",
+		"cmd",
+	)
+)
+
+// redis的连接模式
+const (
+	redisModeSingle   = "single"
+	redisModeCluster  = "cluster"
+	redisModeFailover = "failover"
 )
 
 type (
 
 	// redisHook redis的hook配置
 	redisHook struct {
+		// 连接模式，single、cluster或failover
+		mode string
+		// 是否在hook中限制正在处理数量，
+		// failover模式无法设置client的Limiter，因此在hook中处理
+		limitInHook bool
 		// 连接池大小
 		poolSize int
 		// 最大正在处理数量
 		maxProcessing uint32
 		// 慢请求阀值
 		slow time.Duration
+		// 各命令的慢请求阀值
+		slowCommands map[string]time.Duration
 		// 正在处理数
 		processing atomic.Uint32
 		// pipe的正在处理数
 		pipeProcessing atomic.Uint32
 		// 总的处理请求数
 		total atomic.Uint64
+		// 各节点的熔断器，redis异常时快速失败
+		breakers *redisBreakerGroup
+		// 各命令的耗时与出错统计
+		cmdStats *redisCmdStatsMap
+		// 各节点的连接创建统计
+		conns *redisConnTracker
 	}
 )
 
@@ -55,7 +90,15 @@ func mustNewRedisClient() (redis.UniversalClient, *redisHook) {
 	}
 	hook := &redisHook{
 		slow:          slow,
+		slowCommands:  redisConfig.SlowCommands,
 		maxProcessing: redisConfig.MaxProcessing,
+		cmdStats:      newRedisCmdStatsMap(),
+		conns:         newRedisConnTracker(redisConfig.PoolSize),
+		breakers: newRedisBreakerGroup(
+			redisConfig.BreakerRatio,
+			redisConfig.BreakerMinRequests,
+			redisConfig.BreakerCoolDown,
+		),
 	}
 	opts := &redis.UniversalOptions{
 		Addrs:            redisConfig.Addrs,
@@ -64,43 +107,82 @@ func mustNewRedisClient() (redis.UniversalClient, *redisHook) {
 		SentinelPassword: redisConfig.Password,
 		MasterName:       redisConfig.Master,
 		PoolSize:         redisConfig.PoolSize,
+		// 记录各节点创建连接的耗时与频率
+		Dialer: hook.conns.Dialer,
 		OnConnect: func(ctx context.Context, cn *redis.Conn) error {
 			log.Info(ctx).Msg("redis new connection is established")
-			// TODO 可增加创建连接的统计
+			hook.conns.OnConnect()
 			return nil
 		},
 	}
 	var c redis.UniversalClient
+	// 熔断的hook，cluster模式下添加至各节点的client
+	var breakerHook *redisBreakerHook
 	// 需要对增加limiter，因此单独判断处理
 	if opts.MasterName != "" {
-		// TODO 确认有无可能增加limiter
+		// FailoverOptions无Limiter配置，因此在hook的BeforeProcess中限制
 		failoverOpts := opts.Failover()
 		c = redis.NewFailoverClient(failoverOpts)
+		hook.mode = redisModeFailover
+		hook.limitInHook = true
 		hook.poolSize = failoverOpts.PoolSize
+		// master会切换，因此以master名称熔断
+		breakerHook = hook.breakers.NewHook(failoverOpts.MasterName)
 	} else if len(opts.Addrs) > 1 {
 		clusterOpts := opts.Cluster()
 		clusterOpts.NewClient = func(opt *redis.Options) *redis.Client {
 			// 对每个client的增加limiter
 			opt.Limiter = hook
-			return redis.NewClient(opt)
+			client := redis.NewClient(opt)
+			// 每个节点单独熔断
+			client.AddHook(hook.breakers.NewHook(opt.Addr))
+			return client
 		}
 		c = redis.NewClusterClient(clusterOpts)
+		hook.mode = redisModeCluster
 		hook.poolSize = clusterOpts.PoolSize
 	} else {
 		simpleOpts := opts.Simple()
 		simpleOpts.Limiter = hook
 		c = redis.NewClient(simpleOpts)
+		hook.mode = redisModeSingle
 		hook.poolSize = simpleOpts.PoolSize
+		breakerHook = hook.breakers.NewHook(simpleOpts.Addr)
 	}
 	c.AddHook(hook)
+	// 在hook之后添加，被hook限制的命令不经过熔断校验
+	if breakerHook != nil {
+		c.AddHook(breakerHook)
+	}
 	return c, hook
 }
 
-// 对于慢或出错请求输出日志
-func (rh *redisHook) logSlowOrError(ctx context.Context, cmd, err string) {
+// 获取redis命令的处理时长
+func getRedisProcessDuration(ctx context.Context) time.Duration {
 	t := ctx.Value(startedAtKey).(time.Time)
-	d := time.Since(t)
-	if d > rh.slow || err != "" {
+	return time.Since(t)
+}
+
+// 记录命令耗时与出错次数
+func (rh *redisHook) observe(cmd string, d time.Duration, hasError bool) {
+	redisCmdDuration.Observe(d.Seconds(), cmd)
+	if hasError {
+		redisCmdErrors.Inc(cmd)
+	}
+	rh.cmdStats.Add(cmd, d, hasError)
+}
+
+// getSlow 获取命令的慢请求阀值，未单独配置则使用默认值
+func (rh *redisHook) getSlow(name string) time.Duration {
+	if slow, ok := rh.slowCommands[name]; ok {
+		return slow
+	}
+	return rh.slow
+}
+
+// 对于慢或出错请求输出日志
+func (rh *redisHook) logSlowOrError(ctx context.Context, name, cmd, err string, d time.Duration) {
+	if d > rh.getSlow(name) || err != "" {
 		log.Info(ctx).
 			Str("category", "redisSlowOrErr").
 			Str("cmd", cmd).
@@ -115,7 +197,8 @@ func (rh *redisHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (contex
 	ctx = context.WithValue(ctx, startedAtKey, time.Now())
 	rh.processing.Inc()
 	rh.total.Inc()
-	return ctx, nil
+	// 返回出错时AfterProcess也会触发，因此正在处理数可正常减少
+	return ctx, rh.allowInHook()
 }
 
 // AfterProcess redis处理命令后的hook函数
@@ -126,7 +209,10 @@ func (rh *redisHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
 	if err != nil {
 		message = err.Error()
 	}
-	rh.logSlowOrError(ctx, cmd.FullName(), message)
+	d := getRedisProcessDuration(ctx)
+	rh.observe(cmd.Name(), d, err != nil && !RedisIsNilError(err))
+	rh.logSlowOrError(ctx, cmd.Name(), cmd.FullName(), message, d)
+	rh.reportResult(err)
 	rh.processing.Dec()
 	return nil
 }
@@ -136,7 +222,7 @@ func (rh *redisHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmd
 	ctx = context.WithValue(ctx, startedAtKey, time.Now())
 	rh.pipeProcessing.Inc()
 	rh.total.Inc()
-	return ctx, nil
+	return ctx, rh.allowInHook()
 }
 
 // AfterProcessPipeline redis pipeline命令后的hook函数
@@ -144,6 +230,7 @@ func (rh *redisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmde
 	// allow返回error时也触发
 	cmdSb := new(strings.Builder)
 	message := ""
+	hasError := false
 	for index, cmd := range cmds {
 		if index != 0 {
 			cmdSb.WriteString(",")
@@ -152,9 +239,20 @@ func (rh *redisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmde
 		err := cmd.Err()
 		if err != nil {
 			message += err.Error()
+			if !RedisIsNilError(err) {
+				hasError = true
+			}
 		}
 	}
-	rh.logSlowOrError(ctx, cmdSb.String(), message)
+	d := getRedisProcessDuration(ctx)
+	// pipeline的命令组合较多，统一使用pipeline记录
+	rh.observe("pipeline", d, hasError)
+	rh.logSlowOrError(ctx, "pipeline", cmdSb.String(), message, d)
+	var err error
+	if len(cmds) != 0 {
+		err = cmds[0].Err()
+	}
+	rh.reportResult(err)
 	rh.pipeProcessing.Dec()
 	return nil
 }
@@ -176,6 +274,24 @@ func (rh *redisHook) Allow() error {
 	return nil
 }
 
+// allowInHook 在hook中限制正在处理数量，仅用于无法设置Limiter的模式
+func (rh *redisHook) allowInHook() error {
+	if !rh.limitInHook {
+		return nil
+	}
+	return rh.Allow()
+}
+
+// reportResult 命令执行后记录结果，被限制或熔断的请求则忽略（与Limiter一致）
+func (rh *redisHook) reportResult(err error) {
+	if !rh.limitInHook ||
+		err == ErrRedisTooManyProcessing ||
+		err == ErrRedisCircuitOpen {
+		return
+	}
+	rh.ReportResult(err)
+}
+
 // ReportResult 记录结果
 func (*redisHook) ReportResult(result error) {
 	// 需要注意，只有allow通过后才会触发
@@ -188,11 +304,24 @@ func (*redisHook) ReportResult(result error) {
 	}
 }
 
+// limiterType 获取正在处理数量的限制方式
+func (rh *redisHook) limiterType() string {
+	if rh.limitInHook {
+		return "hook"
+	}
+	return "client"
+}
+
 // RedisGetClient 获取redis client
 func RedisGetClient() redis.UniversalClient {
 	return defaultRedisClient
 }
 
+// RedisClose 关闭redis连接
+func RedisClose() error {
+	return defaultRedisClient.Close()
+}
+
 // RedisIsNilError 判断是否redis的nil error
 func RedisIsNilError(err error) bool {
 	return err == redis.Nil
@@ -213,6 +342,15 @@ func RedisStats() map[string]interface{} {
 		"pipeProcessing": int(pipeProcessing),
 		"total":          int(total),
 		"poolSize":       defaultRedisHook.poolSize,
+		"mode":           defaultRedisHook.mode,
+		// 正在处理数量的限制方式，client的Limiter或hook
+		"limiter": defaultRedisHook.limiterType(),
+		// 各节点的熔断状态
+		"breakers": defaultRedisHook.breakers.Stats(),
+		// 各命令的统计，pipeline统一使用pipeline记录
+		"commands": defaultRedisHook.cmdStats.Stats(),
+		// 各节点的连接创建统计
+		"conns": defaultRedisHook.conns.Stats(),
 	}
 }
 
@@ -0,0 +1,294 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/vicanso/beginner/log"
+	"github.com/vicanso/hes"
+)
+
+// ErrRedisCircuitOpen redis熔断时的出错
+var ErrRedisCircuitOpen = &hes.Error{
+	Message:    "redis circuit breaker is open",
+	StatusCode: http.StatusServiceUnavailable,
+	Category:   "redis",
+}
+
+// 熔断的状态
+const (
+	redisBreakerClosed   = "closed"
+	redisBreakerOpen     = "open"
+	redisBreakerHalfOpen = "halfOpen"
+)
+
+// 关闭状态下出错比例的统计周期
+const redisBreakerWindow = 10 * time.Second
+
+// redisBreakerContextKey 记录命令已通过熔断校验及是否持有半开状态的试探
+type redisBreakerContextKey struct{}
+
+// redisBreaker redis的熔断器，关闭状态下统计周期内出错比例超过阀值则熔断，
+// 冷却时长后转为半开状态，仅允许一个试探请求，成功则关闭，失败则再次熔断
+type redisBreaker struct {
+	mutex sync.Mutex
+	// 节点地址，非cluster模式则为配置的地址或master名称
+	addr string
+	// 出错比例，为0则不启用
+	ratio float64
+	// 最少请求数
+	minRequests uint32
+	// 冷却时长
+	coolDown time.Duration
+
+	state string
+	// 统计周期开始时间
+	windowStartedAt time.Time
+	requests        uint32
+	failures        uint32
+	// 熔断的时间
+	openedAt time.Time
+	// 半开状态下是否已有试探请求
+	probing bool
+}
+
+func newRedisBreaker(addr string, ratio float64, minRequests uint32, coolDown time.Duration) *redisBreaker {
+	return &redisBreaker{
+		addr:            addr,
+		ratio:           ratio,
+		minRequests:     minRequests,
+		coolDown:        coolDown,
+		state:           redisBreakerClosed,
+		windowStartedAt: time.Now(),
+	}
+}
+
+// redisIsBreakerFailure 判断是否需要计入熔断的出错，
+// 仅连接类的出错计入，redis返回的出错（如WRONGTYPE）与nil不计入
+func redisIsBreakerFailure(err error) bool {
+	if err == nil ||
+		RedisIsNilError(err) ||
+		errors.Is(err, context.Canceled) {
+		return false
+	}
+	var redisErr redis.Error
+	return !errors.As(err, &redisErr)
+}
+
+// setState 切换状态，需要在加锁后调用
+func (rb *redisBreaker) setState(state string) {
+	if rb.state == state {
+		return
+	}
+	log.Warn(context.Background()).
+		Str("category", "redisBreaker").
+		Str("addr", rb.addr).
+		Str("from", rb.state).
+		Str("to", state).
+		Uint32("requests", rb.requests).
+		Uint32("failures", rb.failures).
+		Msg("")
+	rb.state = state
+	rb.probing = false
+	rb.requests = 0
+	rb.failures = 0
+	rb.windowStartedAt = time.Now()
+	if state == redisBreakerOpen {
+		rb.openedAt = rb.windowStartedAt
+	}
+}
+
+// Allow 是否允许执行redis命令，返回该命令是否为半开状态的试探请求
+func (rb *redisBreaker) Allow() (bool, error) {
+	if rb.ratio <= 0 {
+		return false, nil
+	}
+	rb.mutex.Lock()
+	defer rb.mutex.Unlock()
+	switch rb.state {
+	case redisBreakerOpen:
+		if time.Since(rb.openedAt) < rb.coolDown {
+			return false, ErrRedisCircuitOpen
+		}
+		rb.setState(redisBreakerHalfOpen)
+		rb.probing = true
+		return true, nil
+	case redisBreakerHalfOpen:
+		if rb.probing {
+			return false, ErrRedisCircuitOpen
+		}
+		rb.probing = true
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// ReportResult 记录通过Allow的命令的结果，半开状态下仅试探请求的结果生效，
+// 熔断前已开始执行的命令忽略
+func (rb *redisBreaker) ReportResult(probe bool, err error) {
+	if rb.ratio <= 0 {
+		return
+	}
+	rb.mutex.Lock()
+	defer rb.mutex.Unlock()
+	// 被limiter拒绝的命令未实际执行，若为试探请求则释放试探
+	if err == ErrRedisTooManyProcessing {
+		if probe && rb.state == redisBreakerHalfOpen {
+			rb.probing = false
+		}
+		return
+	}
+	failed := redisIsBreakerFailure(err)
+	switch rb.state {
+	case redisBreakerHalfOpen:
+		if !probe {
+			return
+		}
+		if failed {
+			rb.setState(redisBreakerOpen)
+		} else {
+			rb.setState(redisBreakerClosed)
+		}
+	case redisBreakerClosed:
+		if time.Since(rb.windowStartedAt) > redisBreakerWindow {
+			rb.windowStartedAt = time.Now()
+			rb.requests = 0
+			rb.failures = 0
+		}
+		rb.requests++
+		if failed {
+			rb.failures++
+		}
+		if rb.requests >= rb.minRequests &&
+			float64(rb.failures) >= float64(rb.requests)*rb.ratio {
+			rb.setState(redisBreakerOpen)
+		}
+	}
+}
+
+// Stats 获取熔断的状态
+func (rb *redisBreaker) Stats() map[string]interface{} {
+	rb.mutex.Lock()
+	defer rb.mutex.Unlock()
+	state := rb.state
+	if rb.ratio <= 0 {
+		state = "disabled"
+	}
+	stats := map[string]interface{}{
+		"state":    state,
+		"requests": int(rb.requests),
+		"failures": int(rb.failures),
+	}
+	if !rb.openedAt.IsZero() {
+		stats["openedAt"] = rb.openedAt
+	}
+	return stats
+}
+
+// redisBreakerGroup 各节点的熔断器，cluster模式下每个节点单独熔断，
+// 避免单个节点异常时所有节点的命令均被熔断
+type redisBreakerGroup struct {
+	mutex       sync.Mutex
+	ratio       float64
+	minRequests uint32
+	coolDown    time.Duration
+	breakers    map[string]*redisBreaker
+}
+
+func newRedisBreakerGroup(ratio float64, minRequests uint32, coolDown time.Duration) *redisBreakerGroup {
+	return &redisBreakerGroup{
+		ratio:       ratio,
+		minRequests: minRequests,
+		coolDown:    coolDown,
+		breakers:    make(map[string]*redisBreaker),
+	}
+}
+
+// Get 获取节点的熔断器，不存在则创建（节点的client重建时复用）
+func (bg *redisBreakerGroup) Get(addr string) *redisBreaker {
+	bg.mutex.Lock()
+	defer bg.mutex.Unlock()
+	rb, ok := bg.breakers[addr]
+	if !ok {
+		rb = newRedisBreaker(addr, bg.ratio, bg.minRequests, bg.coolDown)
+		bg.breakers[addr] = rb
+	}
+	return rb
+}
+
+// NewHook 创建节点的熔断hook
+func (bg *redisBreakerGroup) NewHook(addr string) *redisBreakerHook {
+	return &redisBreakerHook{
+		breaker: bg.Get(addr),
+	}
+}
+
+// Stats 获取各节点熔断的状态
+func (bg *redisBreakerGroup) Stats() map[string]interface{} {
+	bg.mutex.Lock()
+	breakers := make(map[string]*redisBreaker, len(bg.breakers))
+	for addr, rb := range bg.breakers {
+		breakers[addr] = rb
+	}
+	bg.mutex.Unlock()
+	stats := make(map[string]interface{}, len(breakers))
+	for addr, rb := range breakers {
+		stats[addr] = rb.Stats()
+	}
+	return stats
+}
+
+// redisBreakerHook 熔断的hook，需在限制正在处理数量的hook之后添加，
+// 被限制的命令不会经过熔断校验
+type redisBreakerHook struct {
+	breaker *redisBreaker
+}
+
+// allow 熔断校验，通过则在context中记录是否持有试探
+func (bh *redisBreakerHook) allow(ctx context.Context) (context.Context, error) {
+	probe, err := bh.breaker.Allow()
+	if err != nil {
+		return ctx, err
+	}
+	return context.WithValue(ctx, redisBreakerContextKey{}, probe), nil
+}
+
+// report 记录结果，未通过熔断校验的命令忽略，仅持有试探的命令可结束半开状态
+func (bh *redisBreakerHook) report(ctx context.Context, err error) {
+	probe, ok := ctx.Value(redisBreakerContextKey{}).(bool)
+	if !ok {
+		return
+	}
+	bh.breaker.ReportResult(probe, err)
+}
+
+// BeforeProcess 命令执行前的熔断校验
+func (bh *redisBreakerHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return bh.allow(ctx)
+}
+
+// AfterProcess 记录命令的结果
+func (bh *redisBreakerHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	bh.report(ctx, cmd.Err())
+	return nil
+}
+
+// BeforeProcessPipeline pipeline执行前的熔断校验
+func (bh *redisBreakerHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return bh.allow(ctx)
+}
+
+// AfterProcessPipeline 记录pipeline的结果，以第一个命令的出错为准
+func (bh *redisBreakerHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	if len(cmds) != 0 {
+		err = cmds[0].Err()
+	}
+	bh.report(ctx, err)
+	return nil
+}
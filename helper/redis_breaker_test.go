@@ -0,0 +1,95 @@
+package helper
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// openTestBreaker 生成已熔断且冷却时长已过的熔断器
+func openTestBreaker(t *testing.T) *redisBreaker {
+	rb := newRedisBreaker("127.0.0.1:6379", 0.5, 1, time.Millisecond)
+	_, err := rb.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rb.ReportResult(false, io.EOF)
+	if rb.state != redisBreakerOpen {
+		t.Fatal("should be open")
+	}
+	time.Sleep(2 * time.Millisecond)
+	return rb
+}
+
+func TestRedisBreakerProbe(t *testing.T) {
+	rb := openTestBreaker(t)
+	probe, err := rb.Allow()
+	if err != nil || !probe {
+		t.Fatal("first command after cool down should be the probe")
+	}
+	_, err = rb.Allow()
+	if err != ErrRedisCircuitOpen {
+		t.Fatal("should reject when probing")
+	}
+
+	// 非试探请求（如熔断前已开始执行）的结果不影响半开状态
+	rb.ReportResult(false, nil)
+	rb.ReportResult(false, ErrRedisTooManyProcessing)
+	if rb.state != redisBreakerHalfOpen || !rb.probing {
+		t.Fatal("only the probe should release the half open state")
+	}
+
+	// 试探请求被limiter拒绝，释放试探
+	rb.ReportResult(true, ErrRedisTooManyProcessing)
+	if rb.state != redisBreakerHalfOpen || rb.probing {
+		t.Fatal("probe rejected by limiter should be released")
+	}
+
+	probe, err = rb.Allow()
+	if err != nil || !probe {
+		t.Fatal("should take the probe again")
+	}
+	rb.ReportResult(true, nil)
+	if rb.state != redisBreakerClosed {
+		t.Fatal("should be closed after probe success")
+	}
+}
+
+func TestRedisBreakerProbeFail(t *testing.T) {
+	rb := openTestBreaker(t)
+	probe, err := rb.Allow()
+	if err != nil || !probe {
+		t.Fatal("should take the probe")
+	}
+	rb.ReportResult(true, errors.New("dial tcp: connection refused"))
+	if rb.state != redisBreakerOpen {
+		t.Fatal("should be open after probe fail")
+	}
+}
+
+func TestRedisBreakerGroup(t *testing.T) {
+	bg := newRedisBreakerGroup(0.5, 1, time.Minute)
+	a := bg.Get("127.0.0.1:7000")
+	if bg.Get("127.0.0.1:7000") != a {
+		t.Fatal("should reuse the breaker of the same node")
+	}
+	b := bg.Get("127.0.0.1:7001")
+
+	_, _ = a.Allow()
+	a.ReportResult(false, io.EOF)
+	_, err := a.Allow()
+	if err != ErrRedisCircuitOpen {
+		t.Fatal("node a should be open")
+	}
+	_, err = b.Allow()
+	if err != nil {
+		t.Fatal("node b should not be affected")
+	}
+	stats := bg.Stats()
+	if len(stats) != 2 ||
+		stats["127.0.0.1:7000"].(map[string]interface{})["state"] != redisBreakerOpen ||
+		stats["127.0.0.1:7001"].(map[string]interface{})["state"] != redisBreakerClosed {
+		t.Fatalf("unexpected stats: %v", stats)
+	}
+}
@@ -0,0 +1,154 @@
+package helper
+
+import (
+	"context"
+	"net"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/vicanso/beginner/log"
+)
+
+// 连接创建速率的统计周期（秒），每秒一个桶
+const redisConnRateWindow = 60
+
+type (
+	// redisNodeConnStats 单个节点的连接创建统计
+	redisNodeConnStats struct {
+		// 创建连接次数
+		dials uint64
+		// 创建失败次数
+		dialErrors uint64
+		// 创建连接的总耗时与最大耗时
+		dialTotal time.Duration
+		dialMax   time.Duration
+		// 最近一次创建连接的时间
+		lastDialAt time.Time
+		// 每秒的创建次数（环形），用于计算最近一分钟的创建数
+		buckets   [redisConnRateWindow]uint32
+		bucketsAt [redisConnRateWindow]int64
+		// 最近一次输出连接频繁创建日志的时间，避免日志过多
+		churnLoggedAt time.Time
+	}
+	// redisConnTracker 各节点的连接创建统计
+	redisConnTracker struct {
+		mutex sync.Mutex
+		// 每个节点的连接池大小，最近一分钟创建连接数超过其2倍则认为连接频繁创建
+		poolSize int
+		// 连接成功初始化（OnConnect）的次数
+		connected uint64
+		nodes     map[string]*redisNodeConnStats
+	}
+)
+
+func newRedisConnTracker(poolSize int) *redisConnTracker {
+	// 与go-redis一致，未配置时为10倍的GOMAXPROCS
+	if poolSize <= 0 {
+		poolSize = 10 * runtime.GOMAXPROCS(0)
+	}
+	return &redisConnTracker{
+		poolSize: poolSize,
+		nodes:    make(map[string]*redisNodeConnStats),
+	}
+}
+
+// recentDials 最近一分钟的创建连接数
+func (ns *redisNodeConnStats) recentDials(now int64) int {
+	count := 0
+	for index, at := range ns.bucketsAt {
+		if now-at < redisConnRateWindow {
+			count += int(ns.buckets[index])
+		}
+	}
+	return count
+}
+
+// Dialer 创建连接并记录耗时，在所有模式下均为实际节点的地址
+func (ct *redisConnTracker) Dialer(ctx context.Context, network, addr string) (net.Conn, error) {
+	startedAt := time.Now()
+	netDialer := &net.Dialer{
+		// 与go-redis默认的配置一致
+		Timeout:   5 * time.Second,
+		KeepAlive: 5 * time.Minute,
+	}
+	conn, err := netDialer.DialContext(ctx, network, addr)
+	ct.add(addr, time.Since(startedAt), err)
+	return conn, err
+}
+
+// add 添加创建连接的记录
+func (ct *redisConnTracker) add(addr string, d time.Duration, err error) {
+	ct.mutex.Lock()
+	defer ct.mutex.Unlock()
+	ns, ok := ct.nodes[addr]
+	if !ok {
+		ns = &redisNodeConnStats{}
+		ct.nodes[addr] = ns
+	}
+	now := time.Now()
+	ns.dials++
+	ns.lastDialAt = now
+	if err != nil {
+		ns.dialErrors++
+	}
+	ns.dialTotal += d
+	if d > ns.dialMax {
+		ns.dialMax = d
+	}
+	sec := now.Unix()
+	index := sec % redisConnRateWindow
+	if ns.bucketsAt[index] != sec {
+		ns.bucketsAt[index] = sec
+		ns.buckets[index] = 0
+	}
+	ns.buckets[index]++
+
+	recent := ns.recentDials(sec)
+	if recent > 2*ct.poolSize && now.Sub(ns.churnLoggedAt) > time.Minute {
+		ns.churnLoggedAt = now
+		log.Warn(context.Background()).
+			Str("category", "redisConnChurn").
+			Str("addr", addr).
+			Int("recentDials", recent).
+			Int("poolSize", ct.poolSize).
+			Msg("")
+	}
+}
+
+// OnConnect 连接初始化成功的回调
+func (ct *redisConnTracker) OnConnect() {
+	ct.mutex.Lock()
+	ct.connected++
+	ct.mutex.Unlock()
+}
+
+// Stats 获取连接创建的统计
+func (ct *redisConnTracker) Stats() map[string]interface{} {
+	ct.mutex.Lock()
+	defer ct.mutex.Unlock()
+	now := time.Now()
+	sec := now.Unix()
+	nodes := make(map[string]interface{}, len(ct.nodes))
+	for addr, ns := range ct.nodes {
+		var avg time.Duration
+		if ns.dials != 0 {
+			avg = ns.dialTotal / time.Duration(ns.dials)
+		}
+		recent := ns.recentDials(sec)
+		nodes[addr] = map[string]interface{}{
+			"dials":      int(ns.dials),
+			"dialErrors": int(ns.dialErrors),
+			// 最近一分钟的创建连接数
+			"perMinute":  recent,
+			"dialAvg":    avg.String(),
+			"dialMax":    ns.dialMax.String(),
+			"lastDialAt": ns.lastDialAt,
+			"churn":      recent > 2*ct.poolSize,
+		}
+	}
+	return map[string]interface{}{
+		"connected": int(ct.connected),
+		"nodes":     nodes,
+	}
+}
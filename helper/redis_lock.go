@@ -0,0 +1,233 @@
+package helper
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/vicanso/beginner/log"
+	"github.com/vicanso/beginner/util"
+	"github.com/vicanso/hes"
+)
+
+var (
+	// ErrRedisLockTimeout 等待获取锁超时
+	ErrRedisLockTimeout = &hes.Error{
+		Message:    "获取锁超时，请稍候再试",
+		StatusCode: http.StatusConflict,
+		Category:   "redisLock",
+	}
+	// ErrRedisLockNotHeld 锁已过期或被其它实例持有
+	ErrRedisLockNotHeld = &hes.Error{
+		Message:    "锁已失效",
+		StatusCode: http.StatusConflict,
+		Category:   "redisLock",
+	}
+)
+
+// 获取锁失败后重试的间隔
+const redisLockRetryInterval = 50 * time.Millisecond
+
+// 锁不存在时设置锁，并递增fencing token，返回token，
+// 锁已存在则返回0
+var redisLockAcquireScript = redis.NewScript(`
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return redis.call("INCR", KEYS[2])
+end
+return 0
+`)
+
+// 锁的值一致时才延长过期时间
+var redisLockRenewScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// 锁的值一致时才删除，避免删除其它实例的锁
+var redisLockReleaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// RedisLock redis分布式锁，持有期间自动续期
+type RedisLock struct {
+	key   string
+	value string
+	ttl   time.Duration
+	// 单调递增的fencing token
+	fence int64
+	// 锁释放或失效时取消
+	ctx    context.Context
+	cancel context.CancelFunc
+	// 续期的goroutine结束
+	done chan struct{}
+
+	mutex    sync.Mutex
+	released bool
+}
+
+// 锁的key与fencing token的key，使用相同的hash tag，保证cluster模式下在同一slot
+func getRedisLockKeys(key string) []string {
+	return []string{
+		"lock:{" + key + "}",
+		"lock:{" + key + "}:fence",
+	}
+}
+
+// RedisLockAcquire 获取锁，在wait时长内重试，超时返回ErrRedisLockTimeout，ttl需大于0。
+// 获取成功后每ttl/3续期一次，直至Release或ctx取消（取消时自动释放锁）
+func RedisLockAcquire(ctx context.Context, key string, ttl, wait time.Duration) (*RedisLock, error) {
+	keys := getRedisLockKeys(key)
+	value := util.GenXID()
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		fence, err := redisLockAcquireScript.Run(
+			ctx,
+			RedisGetClient(),
+			keys,
+			value,
+			ttl.Milliseconds(),
+		).Int64()
+		if err != nil {
+			return nil, err
+		}
+		if fence != 0 {
+			lockCtx, cancel := context.WithCancel(ctx)
+			l := &RedisLock{
+				key:    key,
+				value:  value,
+				ttl:    ttl,
+				fence:  fence,
+				ctx:    lockCtx,
+				cancel: cancel,
+				done:   make(chan struct{}),
+			}
+			go l.keepAlive()
+			return l, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+			return nil, ErrRedisLockTimeout.Clone()
+		case <-time.After(redisLockRetryInterval):
+		}
+	}
+}
+
+// keepAlive 定时续期，续期失败且超过ttl或锁被其它实例持有时，则认为锁已失效
+func (l *RedisLock) keepAlive() {
+	defer close(l.done)
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	renewedAt := time.Now()
+	for {
+		select {
+		case <-l.ctx.Done():
+			l.mutex.Lock()
+			released := l.released
+			l.released = true
+			l.mutex.Unlock()
+			// 未调用Release，则为调用方的ctx取消，释放锁
+			if !released {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				_ = l.release(ctx)
+				cancel()
+			}
+			return
+		case <-ticker.C:
+		}
+		result, err := redisLockRenewScript.Run(
+			l.ctx,
+			RedisGetClient(),
+			getRedisLockKeys(l.key)[:1],
+			l.value,
+			l.ttl.Milliseconds(),
+		).Int()
+		if err == nil && result == 1 {
+			renewedAt = time.Now()
+			continue
+		}
+		// ctx已取消导致的出错则忽略
+		if l.ctx.Err() != nil {
+			continue
+		}
+		if err == nil || time.Since(renewedAt) >= l.ttl {
+			log.Warn(l.ctx).
+				Str("category", "redisLockLost").
+				Str("key", l.key).
+				Int64("fence", l.fence).
+				Err(err).
+				Msg("")
+			l.cancel()
+			return
+		}
+	}
+}
+
+// Fence 获取fencing token，写入共享资源时带上此值，资源方拒绝小于已处理值的请求
+func (l *RedisLock) Fence() int64 {
+	return l.fence
+}
+
+// Context 获取锁的context，锁释放或失效时取消
+func (l *RedisLock) Context() context.Context {
+	return l.ctx
+}
+
+// Release 释放锁，锁已失效则返回ErrRedisLockNotHeld，重复调用无影响
+func (l *RedisLock) Release(ctx context.Context) error {
+	l.mutex.Lock()
+	if l.released {
+		l.mutex.Unlock()
+		return nil
+	}
+	l.released = true
+	l.mutex.Unlock()
+
+	l.cancel()
+	<-l.done
+	return l.release(ctx)
+}
+
+// release 删除锁，锁的值一致时才删除
+func (l *RedisLock) release(ctx context.Context) error {
+	result, err := redisLockReleaseScript.Run(
+		ctx,
+		RedisGetClient(),
+		getRedisLockKeys(l.key)[:1],
+		l.value,
+	).Int()
+	if err != nil {
+		return err
+	}
+	if result == 0 {
+		return ErrRedisLockNotHeld.Clone()
+	}
+	return nil
+}
+
+// RedisWithLock 获取锁后执行fn，执行完成后释放锁。
+// fn的context在锁失效时取消，fence为该次获取锁的fencing token
+func RedisWithLock(ctx context.Context, key string, ttl, wait time.Duration, fn func(ctx context.Context, fence int64) error) error {
+	l, err := RedisLockAcquire(ctx, key, ttl, wait)
+	if err != nil {
+		return err
+	}
+	err = fn(l.Context(), l.Fence())
+	// 使用新的context释放，避免ctx已取消导致无法释放
+	releaseCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	releaseErr := l.Release(releaseCtx)
+	if err != nil {
+		return err
+	}
+	return releaseErr
+}
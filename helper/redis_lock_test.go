@@ -0,0 +1,283 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vicanso/beginner/internal/redistest"
+	"github.com/vicanso/hes"
+)
+
+// isHesError 判断是否对应的hes error（Clone后为新的实例）
+func isHesError(err, target error) bool {
+	he, ok := err.(*hes.Error)
+	if !ok {
+		return false
+	}
+	targetHe := target.(*hes.Error)
+	return he.Category == targetHe.Category && he.Message == targetHe.Message
+}
+
+// waitFor 等待条件满足，超时则失败
+func waitFor(t *testing.T, timeout time.Duration, fn func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !fn() {
+		if time.Now().After(deadline) {
+			t.Fatal("wait for condition timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRedisLockAcquireTimeout(t *testing.T) {
+	redistest.Run(t, &defaultRedisClient)
+	ctx := context.Background()
+
+	l, err := RedisLockAcquire(ctx, "acquire", time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Release(ctx)
+
+	startedAt := time.Now()
+	_, err = RedisLockAcquire(ctx, "acquire", time.Second, 100*time.Millisecond)
+	if !isHesError(err, ErrRedisLockTimeout) {
+		t.Fatalf("should return lock timeout, got %v", err)
+	}
+	if time.Since(startedAt) < 100*time.Millisecond {
+		t.Fatal("should wait before timeout")
+	}
+
+	// 其它key不受影响
+	other, err := RedisLockAcquire(ctx, "acquireOther", time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Release(ctx)
+}
+
+func TestRedisLockAcquireWait(t *testing.T) {
+	redistest.Run(t, &defaultRedisClient)
+	ctx := context.Background()
+
+	l, err := RedisLockAcquire(ctx, "wait", time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_ = l.Release(ctx)
+	}()
+	next, err := RedisLockAcquire(ctx, "wait", time.Second, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer next.Release(ctx)
+	if next.Fence() <= l.Fence() {
+		t.Fatalf("fence should increase, %d <= %d", next.Fence(), l.Fence())
+	}
+}
+
+func TestRedisLockFence(t *testing.T) {
+	mr := redistest.Run(t, &defaultRedisClient)
+	ctx := context.Background()
+
+	var prev int64
+	for i := 0; i < 5; i++ {
+		l, err := RedisLockAcquire(ctx, "fence", time.Second, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if l.Fence() <= prev {
+			t.Fatalf("fence should increase, %d <= %d", l.Fence(), prev)
+		}
+		prev = l.Fence()
+		err = l.Release(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 锁过期后重新获取，fence仍递增
+	l, err := RedisLockAcquire(ctx, "fence", time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr.FastForward(2 * time.Second)
+	next, err := RedisLockAcquire(ctx, "fence", time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer next.Release(ctx)
+	if next.Fence() <= l.Fence() {
+		t.Fatalf("fence should increase after expired, %d <= %d", next.Fence(), l.Fence())
+	}
+}
+
+func TestRedisLockRenew(t *testing.T) {
+	mr := redistest.Run(t, &defaultRedisClient)
+	ctx := context.Background()
+	ttl := 300 * time.Millisecond
+
+	l, err := RedisLockAcquire(ctx, "renew", ttl, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := getRedisLockKeys("renew")[0]
+	// miniredis的过期时间需要手动推进，累计推进的时长远大于ttl
+	for i := 0; i < 5; i++ {
+		time.Sleep(ttl / 2)
+		mr.FastForward(ttl / 2)
+		if !mr.Exists(key) {
+			t.Fatalf("lock should be renewed, round %d", i)
+		}
+	}
+	if l.Context().Err() != nil {
+		t.Fatal("lock context should not be canceled")
+	}
+	err = l.Release(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists(key) {
+		t.Fatal("lock should be deleted after release")
+	}
+	if l.Context().Err() == nil {
+		t.Fatal("lock context should be canceled after release")
+	}
+	// 重复释放无影响
+	err = l.Release(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRedisLockReleaseNotHeld(t *testing.T) {
+	mr := redistest.Run(t, &defaultRedisClient)
+	ctx := context.Background()
+	key := getRedisLockKeys("notHeld")[0]
+
+	// 被其它实例持有
+	l, err := RedisLockAcquire(ctx, "notHeld", time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = mr.Set(key, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = l.Release(ctx)
+	if !isHesError(err, ErrRedisLockNotHeld) {
+		t.Fatalf("should return not held, got %v", err)
+	}
+	value, _ := mr.Get(key)
+	if value != "other" {
+		t.Fatal("should not delete the lock of others")
+	}
+	mr.Del(key)
+
+	// 已过期
+	l, err = RedisLockAcquire(ctx, "notHeld", time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr.FastForward(2 * time.Second)
+	err = l.Release(ctx)
+	if !isHesError(err, ErrRedisLockNotHeld) {
+		t.Fatalf("should return not held, got %v", err)
+	}
+}
+
+func TestRedisLockLost(t *testing.T) {
+	mr := redistest.Run(t, &defaultRedisClient)
+	ctx := context.Background()
+	ttl := 300 * time.Millisecond
+
+	l, err := RedisLockAcquire(ctx, "lost", ttl, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = mr.Set(getRedisLockKeys("lost")[0], "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 续期时发现锁被其它实例持有，取消锁的context
+	select {
+	case <-l.Context().Done():
+	case <-time.After(ttl):
+		t.Fatal("lock context should be canceled when lost")
+	}
+	err = l.Release(ctx)
+	if !isHesError(err, ErrRedisLockNotHeld) {
+		t.Fatalf("should return not held, got %v", err)
+	}
+}
+
+func TestRedisLockContextCancel(t *testing.T) {
+	mr := redistest.Run(t, &defaultRedisClient)
+	key := getRedisLockKeys("cancel")[0]
+
+	ctx, cancel := context.WithCancel(context.Background())
+	l, err := RedisLockAcquire(ctx, "cancel", time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	waitFor(t, time.Second, func() bool {
+		return !mr.Exists(key)
+	})
+	// 已自动释放，再次释放无影响
+	err = l.Release(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 等待获取锁时取消
+	holder, err := RedisLockAcquire(context.Background(), "cancel", time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer holder.Release(context.Background())
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = RedisLockAcquire(ctx, "cancel", time.Second, time.Second)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("should return context error, got %v", err)
+	}
+}
+
+func TestRedisWithLock(t *testing.T) {
+	mr := redistest.Run(t, &defaultRedisClient)
+	key := getRedisLockKeys("with")[0]
+
+	var fence int64
+	err := RedisWithLock(context.Background(), "with", time.Second, 0, func(ctx context.Context, f int64) error {
+		if !mr.Exists(key) {
+			return errors.New("lock should be held")
+		}
+		fence = f
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fence == 0 {
+		t.Fatal("fence should be set")
+	}
+	if mr.Exists(key) {
+		t.Fatal("lock should be released")
+	}
+
+	fnErr := errors.New("fn error")
+	err = RedisWithLock(context.Background(), "with", time.Second, 0, func(ctx context.Context, _ int64) error {
+		return fnErr
+	})
+	if err != fnErr {
+		t.Fatalf("should return fn error, got %v", err)
+	}
+	if mr.Exists(key) {
+		t.Fatal("lock should be released when fn fails")
+	}
+}
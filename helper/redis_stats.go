@@ -0,0 +1,96 @@
+package helper
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// 每个命令保留最近的耗时样本数，用于计算耗时分布
+const redisCmdSampleSize = 512
+
+type (
+	// redisCmdStats 单个命令的统计
+	redisCmdStats struct {
+		// 总的执行次数
+		count uint64
+		// 出错次数（不包括nil）
+		errors uint64
+		// 最近的耗时样本（环形）
+		samples []time.Duration
+		// 下一个样本写入的位置
+		index int
+	}
+	// redisCmdStatsMap 各命令的统计
+	redisCmdStatsMap struct {
+		mutex sync.Mutex
+		m     map[string]*redisCmdStats
+	}
+)
+
+func newRedisCmdStatsMap() *redisCmdStatsMap {
+	return &redisCmdStatsMap{
+		m: make(map[string]*redisCmdStats),
+	}
+}
+
+// Add 添加命令的执行记录
+func (sm *redisCmdStatsMap) Add(cmd string, d time.Duration, hasError bool) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	stats, ok := sm.m[cmd]
+	if !ok {
+		stats = &redisCmdStats{
+			samples: make([]time.Duration, 0, redisCmdSampleSize),
+		}
+		sm.m[cmd] = stats
+	}
+	stats.count++
+	if hasError {
+		stats.errors++
+	}
+	if len(stats.samples) < redisCmdSampleSize {
+		stats.samples = append(stats.samples, d)
+		return
+	}
+	stats.samples[stats.index] = d
+	stats.index = (stats.index + 1) % redisCmdSampleSize
+}
+
+// redisPercentile 获取已排序耗时的百分位
+func redisPercentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	index := int(float64(len(sorted))*p+0.5) - 1
+	if index < 0 {
+		index = 0
+	}
+	if index >= len(sorted) {
+		index = len(sorted) - 1
+	}
+	return sorted[index]
+}
+
+// Stats 获取各命令的统计，耗时分布与最大值基于最近的样本
+func (sm *redisCmdStatsMap) Stats() map[string]interface{} {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	result := make(map[string]interface{}, len(sm.m))
+	for cmd, stats := range sm.m {
+		sorted := make([]time.Duration, len(stats.samples))
+		copy(sorted, stats.samples)
+		sort.Slice(sorted, func(i, j int) bool {
+			return sorted[i] < sorted[j]
+		})
+		result[cmd] = map[string]interface{}{
+			"count":  int(stats.count),
+			"errors": int(stats.errors),
+			"p50":    redisPercentile(sorted, 0.5).String(),
+			"p95":    redisPercentile(sorted, 0.95).String(),
+			"p99":    redisPercentile(sorted, 0.99).String(),
+			"max":    redisPercentile(sorted, 1).String(),
+		}
+	}
+	return result
+}
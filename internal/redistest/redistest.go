@@ -0,0 +1,25 @@
+// Package redistest 测试使用的redis，基于miniredis，仅用于测试
+package redistest
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// Run 启动miniredis并将client替换为连接miniredis的client，
+// 测试结束后恢复原client并关闭miniredis
+func Run(t testing.TB, client *redis.UniversalClient) *miniredis.Miniredis {
+	mr := miniredis.RunT(t)
+	c := redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	})
+	original := *client
+	*client = c
+	t.Cleanup(func() {
+		*client = original
+		_ = c.Close()
+	})
+	return mr
+}
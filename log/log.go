@@ -2,11 +2,13 @@ package log
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
 	"regexp"
 	"strconv"
+	"syscall"
 
 	"github.com/rs/zerolog"
 	"github.com/vicanso/beginner/util"
@@ -82,7 +84,11 @@ func fillTraceInfos(ctx context.Context, e *zerolog.Event) *zerolog.Event {
 		return e
 	}
 	// 记录客户信息
-	return e.Str("account", account)
+	e.Str("account", account)
+	if roles := util.GetRoles(ctx); len(roles) != 0 {
+		e.Strs("roles", roles)
+	}
+	return e
 }
 
 func Info(ctx context.Context) *zerolog.Event {
@@ -101,6 +107,16 @@ func Warn(ctx context.Context) *zerolog.Event {
 	return fillTraceInfos(ctx, defaultLogger.Warn())
 }
 
+// Flush 将日志写入，用于程序退出前调用
+func Flush() error {
+	err := os.Stdout.Sync()
+	// 标准输出为终端或管道时不支持sync
+	if errors.Is(err, syscall.EINVAL) || errors.Is(err, syscall.ENOTTY) {
+		return nil
+	}
+	return err
+}
+
 // URLValues create a url.Values log event
 func URLValues(query url.Values) *zerolog.Event {
 	if len(query) == 0 {
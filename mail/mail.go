@@ -0,0 +1,146 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"time"
+
+	"github.com/vicanso/beginner/config"
+	"github.com/vicanso/beginner/util"
+)
+
+type (
+	// Message 邮件内容
+	Message struct {
+		// 收件人
+		To string
+		// 主题
+		Subject string
+		// 纯文本内容
+		Text string
+		// html内容
+		HTML string
+	}
+	// Transport 邮件的发送方式
+	Transport interface {
+		Send(ctx context.Context, from string, msg *Message) error
+	}
+)
+
+var mailConfig = config.MustGetMailConfig()
+
+var defaultTransport = mustNewTransport(mailConfig)
+
+// mustNewTransport 根据配置生成发送方式
+func mustNewTransport(mailConfig *config.MailConfig) Transport {
+	switch mailConfig.Transport {
+	case "smtp":
+		return NewSMTPTransport(SMTPTransportOptions{
+			Host:     mailConfig.Host,
+			Port:     mailConfig.Port,
+			Username: mailConfig.Username,
+			Password: mailConfig.Password,
+		})
+	case "file":
+		return NewFileTransport(mailConfig.Dir)
+	case "log":
+		return NewLogTransport()
+	default:
+		panic(fmt.Errorf("mail transport(%s) is not support", mailConfig.Transport))
+	}
+}
+
+// Send 使用默认的发送方式发送邮件
+func Send(ctx context.Context, msg *Message) error {
+	return defaultTransport.Send(ctx, mailConfig.From, msg)
+}
+
+// SendTemplate 使用模板生成邮件内容并发送
+func SendTemplate(ctx context.Context, to, name string, data interface{}) error {
+	msg, err := Render(name, data)
+	if err != nil {
+		return err
+	}
+	msg.To = to
+	return Send(ctx, msg)
+}
+
+// Bytes 生成邮件的原始内容（multipart/alternative）
+func (msg *Message) Bytes(from string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w := multipart.NewWriter(buf)
+	headers := []string{
+		"From: " + from,
+		"To: " + msg.To,
+		"Subject: " + mime.QEncoding.Encode("utf-8", msg.Subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"Message-ID: <" + util.GenXID() + "@beginner>",
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/alternative; boundary=" + w.Boundary(),
+	}
+	for _, header := range headers {
+		buf.WriteString(header + "\r\n")
+	}
+	buf.WriteString("\r\n")
+
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		// 纯文本在前，支持html的客户端使用最后的html
+		{
+			contentType: "text/plain; charset=utf-8",
+			content:     msg.Text,
+		},
+		{
+			contentType: "text/html; charset=utf-8",
+			content:     msg.HTML,
+		},
+	}
+	for _, part := range parts {
+		if part.content == "" {
+			continue
+		}
+		pw, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              []string{part.contentType},
+			"Content-Transfer-Encoding": []string{"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		err = writeQuotedPrintable(pw, part.content)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := w.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, content string) error {
+	qw := quotedprintable.NewWriter(w)
+	_, err := qw.Write([]byte(content))
+	if err != nil {
+		return err
+	}
+	return qw.Close()
+}
+
+// getAddress 获取邮件地址，如"beginner <noreply@beginner.local>"则返回noreply@beginner.local
+func getAddress(value string) (string, error) {
+	addr, err := mail.ParseAddress(value)
+	if err != nil {
+		return "", err
+	}
+	return addr.Address, nil
+}
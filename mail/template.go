@@ -0,0 +1,54 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmlTemplate "html/template"
+	"text/template"
+)
+
+//go:embed templates/*
+var templateFS embed.FS
+
+// 邮件模板，每个模板需要有templates/name.txt与templates/name.html
+const (
+	// TemplateVerifyEmail 邮箱验证的模板
+	TemplateVerifyEmail = "verify_email"
+	// TemplateResetPassword 重置密码的模板
+	TemplateResetPassword = "reset_password"
+)
+
+// 各模板对应的邮件主题
+var templateSubjects = map[string]string{
+	TemplateVerifyEmail:   "请验证您的邮箱",
+	TemplateResetPassword: "重置密码",
+}
+
+var (
+	textTemplates = template.Must(template.ParseFS(templateFS, "templates/*.txt"))
+	htmlTemplates = htmlTemplate.Must(htmlTemplate.ParseFS(templateFS, "templates/*.html"))
+)
+
+// Render 根据模板生成邮件内容（不包括收件人）
+func Render(name string, data interface{}) (*Message, error) {
+	subject, ok := templateSubjects[name]
+	if !ok {
+		return nil, fmt.Errorf("mail template(%s) is not found", name)
+	}
+	textBuf := &bytes.Buffer{}
+	err := textTemplates.ExecuteTemplate(textBuf, name+".txt", data)
+	if err != nil {
+		return nil, err
+	}
+	htmlBuf := &bytes.Buffer{}
+	err = htmlTemplates.ExecuteTemplate(htmlBuf, name+".html", data)
+	if err != nil {
+		return nil, err
+	}
+	return &Message{
+		Subject: subject,
+		Text:    textBuf.String(),
+		HTML:    htmlBuf.String(),
+	}, nil
+}
@@ -0,0 +1,157 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/vicanso/beginner/log"
+	"github.com/vicanso/beginner/util"
+)
+
+type (
+	// SMTPTransportOptions smtp发送的配置
+	SMTPTransportOptions struct {
+		Host     string
+		Port     int
+		Username string
+		Password string
+		// STARTTLS使用的tls配置，为空则使用系统的根证书校验Host
+		TLSConfig *tls.Config
+	}
+	smtpTransport struct {
+		opts SMTPTransportOptions
+	}
+	fileTransport struct {
+		dir string
+	}
+	logTransport struct{}
+)
+
+// 未设置超时的context时，smtp发送的超时
+const defaultSMTPTimeout = 10 * time.Second
+
+// NewSMTPTransport 创建smtp的发送方式，服务端支持STARTTLS时则启用，
+// 有配置用户名时使用PLAIN认证（非localhost时需要TLS）
+func NewSMTPTransport(opts SMTPTransportOptions) Transport {
+	return &smtpTransport{
+		opts: opts,
+	}
+}
+
+// Send 通过smtp发送邮件
+func (t *smtpTransport) Send(ctx context.Context, from string, msg *Message) error {
+	fromAddr, err := getAddress(from)
+	if err != nil {
+		return err
+	}
+	toAddr, err := getAddress(msg.To)
+	if err != nil {
+		return err
+	}
+	data, err := msg.Bytes(from)
+	if err != nil {
+		return err
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(defaultSMTPTimeout)
+	}
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(t.opts.Host, strconv.Itoa(t.opts.Port)))
+	if err != nil {
+		return err
+	}
+	// 整个发送过程均受超时限制
+	_ = conn.SetDeadline(deadline)
+	client, err := smtp.NewClient(conn, t.opts.Host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		tlsConfig := t.opts.TLSConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{
+				ServerName: t.opts.Host,
+			}
+		}
+		err = client.StartTLS(tlsConfig)
+		if err != nil {
+			return err
+		}
+	}
+	if t.opts.Username != "" {
+		err = client.Auth(smtp.PlainAuth("", t.opts.Username, t.opts.Password, t.opts.Host))
+		if err != nil {
+			return err
+		}
+	}
+	err = client.Mail(fromAddr)
+	if err != nil {
+		return err
+	}
+	err = client.Rcpt(toAddr)
+	if err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// NewFileTransport 创建保存为文件的发送方式，用于开发环境查看邮件
+func NewFileTransport(dir string) Transport {
+	return &fileTransport{
+		dir: dir,
+	}
+}
+
+// Send 将邮件保存为.eml文件
+func (t *fileTransport) Send(_ context.Context, from string, msg *Message) error {
+	data, err := msg.Bytes(from)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(t.dir, 0700)
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(t.dir, time.Now().Format("20060102150405")+"-"+util.GenXID()+".eml")
+	return os.WriteFile(file, data, 0600)
+}
+
+// NewLogTransport 创建输出至日志的发送方式，用于开发环境
+func NewLogTransport() Transport {
+	return &logTransport{}
+}
+
+// Send 将邮件的纯文本内容输出至日志
+func (*logTransport) Send(ctx context.Context, from string, msg *Message) error {
+	log.Info(ctx).
+		Str("category", "mail").
+		Str("from", from).
+		Str("to", msg.To).
+		Str("subject", msg.Subject).
+		Str("text", msg.Text).
+		Msg("")
+	return nil
+}
@@ -0,0 +1,440 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type (
+	// testSMTPServerOptions 测试smtp服务的配置
+	testSMTPServerOptions struct {
+		// 支持STARTTLS时的证书，为空则不支持
+		certificate *tls.Certificate
+		// 支持PLAIN认证的用户名与密码，为空则不支持认证
+		username string
+		password string
+	}
+	// testSMTPSession 测试smtp服务接收到的数据
+	testSMTPSession struct {
+		tls      bool
+		authUser string
+		from     string
+		to       []string
+		data     string
+	}
+	// testSMTPServer 用于测试的最简smtp服务，仅支持单个连接的发送流程
+	testSMTPServer struct {
+		opts     testSMTPServerOptions
+		listener net.Listener
+
+		mutex   sync.Mutex
+		session *testSMTPSession
+		err     error
+		done    chan struct{}
+	}
+)
+
+// newTestCertificate 生成127.0.0.1的自签名证书
+func newTestCertificate(t *testing.T) (*tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName: "127.0.0.1",
+		},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}, pool
+}
+
+func newTestSMTPServer(t *testing.T, opts testSMTPServerOptions) *testSMTPServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testSMTPServer{
+		opts:     opts,
+		listener: ln,
+		done:     make(chan struct{}),
+	}
+	t.Cleanup(func() {
+		_ = ln.Close()
+	})
+	go s.serve()
+	return s
+}
+
+// Port 获取监听的端口
+func (s *testSMTPServer) Port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// Wait 等待连接处理完成，返回接收到的数据
+func (s *testSMTPServer) Wait(t *testing.T) (*testSMTPSession, error) {
+	select {
+	case <-s.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait for smtp session timeout")
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.session, s.err
+}
+
+func (s *testSMTPServer) serve() {
+	defer close(s.done)
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	session := &testSMTPSession{}
+	err = s.handle(conn, session)
+	s.mutex.Lock()
+	s.session = session
+	s.err = err
+	s.mutex.Unlock()
+}
+
+func (s *testSMTPServer) handle(conn net.Conn, session *testSMTPSession) error {
+	r := bufio.NewReader(conn)
+	write := func(lines ...string) error {
+		_, err := io.WriteString(conn, strings.Join(lines, "\r\n")+"\r\n")
+		return err
+	}
+	err := write("220 127.0.0.1 ESMTP test")
+	if err != nil {
+		return err
+	}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch cmd {
+		case "EHLO":
+			lines := []string{"250-127.0.0.1"}
+			if s.opts.certificate != nil && !session.tls {
+				lines = append(lines, "250-STARTTLS")
+			}
+			if s.opts.username != "" {
+				lines = append(lines, "250-AUTH PLAIN")
+			}
+			lines = append(lines, "250 8BITMIME")
+			err = write(lines...)
+		case "STARTTLS":
+			err = write("220 ready to start tls")
+			if err != nil {
+				return err
+			}
+			tlsConn := tls.Server(conn, &tls.Config{
+				Certificates: []tls.Certificate{*s.opts.certificate},
+			})
+			err = tlsConn.Handshake()
+			if err != nil {
+				return err
+			}
+			conn = tlsConn
+			r = bufio.NewReader(conn)
+			session.tls = true
+		case "AUTH":
+			arr := strings.Split(line, " ")
+			if len(arr) != 3 || strings.ToUpper(arr[1]) != "PLAIN" {
+				err = write("504 unsupported auth")
+				break
+			}
+			buf, _ := base64.StdEncoding.DecodeString(arr[2])
+			values := strings.Split(string(buf), "\x00")
+			if len(values) != 3 ||
+				values[1] != s.opts.username ||
+				values[2] != s.opts.password {
+				err = write("535 authentication failed")
+				break
+			}
+			session.authUser = values[1]
+			err = write("235 authentication succeeded")
+		case "MAIL":
+			session.from = line
+			err = write("250 ok")
+		case "RCPT":
+			session.to = append(session.to, line)
+			err = write("250 ok")
+		case "DATA":
+			err = write("354 end data with <CR><LF>.<CR><LF>")
+			if err != nil {
+				return err
+			}
+			sb := new(strings.Builder)
+			for {
+				dataLine, err := r.ReadString('\n')
+				if err != nil {
+					return err
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				sb.WriteString(strings.TrimPrefix(dataLine, "."))
+			}
+			session.data = sb.String()
+			err = write("250 queued")
+		case "QUIT":
+			return write("221 bye")
+		default:
+			err = write("500 unknown command")
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func newTestMessage() *Message {
+	return &Message{
+		To:      "tree <tree@beginner.local>",
+		Subject: "重置密码",
+		Text:    "点击链接重置密码：http://127.0.0.1/reset-password?token=abc.def",
+		HTML:    `<a href="http://127.0.0.1/reset-password?token=abc.def">重置密码</a>`,
+	}
+}
+
+func TestSMTPTransportSTARTTLSAndAuth(t *testing.T) {
+	cert, pool := newTestCertificate(t)
+	server := newTestSMTPServer(t, testSMTPServerOptions{
+		certificate: cert,
+		username:    "tree",
+		password:    "pass",
+	})
+	transport := NewSMTPTransport(SMTPTransportOptions{
+		Host:     "127.0.0.1",
+		Port:     server.Port(),
+		Username: "tree",
+		Password: "pass",
+		TLSConfig: &tls.Config{
+			ServerName: "127.0.0.1",
+			RootCAs:    pool,
+		},
+	})
+	msg := newTestMessage()
+	err := transport.Send(context.Background(), "beginner <noreply@beginner.local>", msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := server.Wait(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !session.tls {
+		t.Fatal("should use STARTTLS")
+	}
+	if session.authUser != "tree" {
+		t.Fatal("should auth with PLAIN")
+	}
+	if session.from != "MAIL FROM:<noreply@beginner.local> BODY=8BITMIME" &&
+		session.from != "MAIL FROM:<noreply@beginner.local>" {
+		t.Fatalf("unexpected mail from: %s", session.from)
+	}
+	if len(session.to) != 1 || session.to[0] != "RCPT TO:<tree@beginner.local>" {
+		t.Fatalf("unexpected rcpt to: %v", session.to)
+	}
+
+	// 校验邮件的MIME内容
+	m, err := mail.ReadMessage(strings.NewReader(session.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != msg.Subject {
+		t.Fatalf("unexpected subject: %s", subject)
+	}
+	if m.Header.Get("To") != msg.To || m.Header.Get("MIME-Version") != "1.0" {
+		t.Fatal("unexpected headers")
+	}
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("unexpected content type: %s", mediaType)
+	}
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	expects := []struct {
+		contentType string
+		content     string
+	}{
+		{
+			contentType: "text/plain; charset=utf-8",
+			content:     msg.Text,
+		},
+		{
+			contentType: "text/html; charset=utf-8",
+			content:     msg.HTML,
+		},
+	}
+	for _, expect := range expects {
+		part, err := mr.NextRawPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if part.Header.Get("Content-Type") != expect.contentType ||
+			part.Header.Get("Content-Transfer-Encoding") != "quoted-printable" {
+			t.Fatalf("unexpected part headers: %v", part.Header)
+		}
+		buf, err := io.ReadAll(quotedprintable.NewReader(part))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf) != expect.content {
+			t.Fatalf("unexpected part content: %s", string(buf))
+		}
+	}
+	_, err = mr.NextPart()
+	if err != io.EOF {
+		t.Fatal("should only have text and html parts")
+	}
+}
+
+func TestSMTPTransportAuthFail(t *testing.T) {
+	cert, pool := newTestCertificate(t)
+	server := newTestSMTPServer(t, testSMTPServerOptions{
+		certificate: cert,
+		username:    "tree",
+		password:    "pass",
+	})
+	transport := NewSMTPTransport(SMTPTransportOptions{
+		Host:     "127.0.0.1",
+		Port:     server.Port(),
+		Username: "tree",
+		Password: "wrong",
+		TLSConfig: &tls.Config{
+			ServerName: "127.0.0.1",
+			RootCAs:    pool,
+		},
+	})
+	err := transport.Send(context.Background(), "noreply@beginner.local", newTestMessage())
+	if err == nil || !strings.Contains(err.Error(), "535") {
+		t.Fatalf("should return auth fail, got %v", err)
+	}
+	session, _ := server.Wait(t)
+	if session.data != "" {
+		t.Fatal("should not send data when auth fail")
+	}
+}
+
+func TestSMTPTransportUntrustedCertificate(t *testing.T) {
+	cert, _ := newTestCertificate(t)
+	server := newTestSMTPServer(t, testSMTPServerOptions{
+		certificate: cert,
+	})
+	// 未指定根证书，自签名证书校验失败，不会降级为明文发送
+	transport := NewSMTPTransport(SMTPTransportOptions{
+		Host: "127.0.0.1",
+		Port: server.Port(),
+	})
+	err := transport.Send(context.Background(), "noreply@beginner.local", newTestMessage())
+	if err == nil {
+		t.Fatal("should fail with untrusted certificate")
+	}
+	session, _ := server.Wait(t)
+	if session.data != "" {
+		t.Fatal("should not send data when tls fail")
+	}
+}
+
+func TestSMTPTransportWithoutTLSAndAuth(t *testing.T) {
+	server := newTestSMTPServer(t, testSMTPServerOptions{})
+	transport := NewSMTPTransport(SMTPTransportOptions{
+		Host: "127.0.0.1",
+		Port: server.Port(),
+	})
+	err := transport.Send(context.Background(), "noreply@beginner.local", newTestMessage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := server.Wait(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.tls || session.authUser != "" {
+		t.Fatal("should not use tls and auth")
+	}
+	if session.data == "" {
+		t.Fatal("should send data")
+	}
+}
+
+func TestSMTPTransportTimeout(t *testing.T) {
+	// 只接受连接但不响应
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		time.Sleep(time.Second)
+	}()
+	transport := NewSMTPTransport(SMTPTransportOptions{
+		Host: "127.0.0.1",
+		Port: ln.Addr().(*net.TCPAddr).Port,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	startedAt := time.Now()
+	err = transport.Send(ctx, "noreply@beginner.local", newTestMessage())
+	if err == nil {
+		t.Fatal("should timeout")
+	}
+	if time.Since(startedAt) > 500*time.Millisecond {
+		t.Fatal("should stop when context deadline exceeded")
+	}
+}
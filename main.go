@@ -3,24 +3,49 @@ package main
 import (
 	"context"
 	"net/http"
+	"os"
+	"os/signal"
 	"regexp"
+	"strconv"
+	"sync"
+	"syscall"
 	"time"
 
 	humanize "github.com/dustin/go-humanize"
+	"github.com/vicanso/beginner/cache"
 	"github.com/vicanso/beginner/config"
 	_ "github.com/vicanso/beginner/controller"
 	"github.com/vicanso/beginner/helper"
 	"github.com/vicanso/beginner/log"
+	"github.com/vicanso/beginner/metric"
+	M "github.com/vicanso/beginner/middleware"
 	"github.com/vicanso/beginner/router"
 	"github.com/vicanso/beginner/util"
 	"github.com/vicanso/elton"
 	"github.com/vicanso/elton/middleware"
 	"github.com/vicanso/hes"
-	"go.uber.org/atomic"
 )
 
 var basicConfig = config.MustGetBasicConfig()
 
+var metricsConfig = config.MustGetMetricsConfig()
+
+var (
+	shutdownOnce sync.Once
+	// 关闭流程完成
+	shutdownDone = make(chan struct{})
+)
+
+// http请求耗时分布
+var httpRequestDuration = metric.NewHistogramVec(
+	"http_request_duration_seconds",
+	"Latency of http requests",
+	nil,
+	"method",
+	"route",
+	"status",
+)
+
 // 相关依赖服务的校验，主要是数据库等
 func dependServiceCheck() (err error) {
 	err = helper.RedisPing()
@@ -36,6 +61,17 @@ func dependServiceCheck() (err error) {
 	if err != nil {
 		return
 	}
+	// 旧的密码保存方式迁移为argon2id
+	err = helper.EntMigrateLegacyPassword(context.Background())
+	if err != nil {
+		return
+	}
+	// 从redis中加载cookie的签名密钥并订阅更新
+	err = cache.LoadSignedKeys(context.Background(), config.MustGetSessionConfig().Keys)
+	if err != nil {
+		return
+	}
+	cache.SubscribeSignedKeys()
 	return
 }
 
@@ -43,21 +79,21 @@ func main() {
 	e := elton.New()
 
 	scf := config.MustGetSessionConfig()
-	e.SignedKeys = &elton.RWMutexSignedKeys{}
+	// 签名密钥可通过管理后台更新，启动后从redis中加载
+	e.SignedKeys = cache.GetSignedKeys()
 	e.SignedKeys.SetKeys(scf.Keys)
 
-	processingCount := atomic.NewInt32(0)
 	// 所有中间件触发前调用
 	e.OnBefore(func(c *elton.Context) {
 		// 正在处理请求数+1
-		processingCount.Inc()
+		util.IncProcessing()
 		// 设置trace id
 		ctx := util.SetTraceID(c.Context(), util.GenXID())
 		c.WithContext(ctx)
 	})
 	e.OnDone(func(ctx *elton.Context) {
 		// 正在处理请求数-1
-		processingCount.Dec()
+		util.DecProcessing()
 	})
 	// 只有未被处理的error才会触发此回调
 	// 一般的出错均由error中间件处理，不会触发此回调
@@ -75,10 +111,9 @@ func main() {
 			Msg("")
 		if he.Category == middleware.ErrRecoverCategory {
 			// 设置不再处理接收到的请求
-			// 等待10秒后退出程序
-			// 因为会调用sleep，因此启用新的goroutine
-			// 如果有数据库等，可关闭相应的连接
-			go e.GracefulClose(10 * time.Second)
+			// 等待处理中的请求完成后关闭数据库等连接并退出程序
+			// 因为会等待请求处理完成，因此启用新的goroutine
+			go gracefulShutdown(e, "panic")
 		}
 	})
 
@@ -93,6 +128,12 @@ func main() {
 		w.Write([]byte("Method Not Allowed"))
 	}
 
+	// 如果有配置应用前缀，则在路由匹配前删除前缀
+	// 如/api/users/v1/me与/users/v1/me均可访问
+	if len(basicConfig.Prefixes) != 0 {
+		e.Pre(M.NewPrefixURL(basicConfig.Prefixes...))
+	}
+
 	// panic的恢复处理，放在最前
 	e.Use(middleware.NewRecover())
 
@@ -130,6 +171,12 @@ func main() {
 				// 响应数据大小（字节）
 				Int("bytes", si.Size).
 				Msg("")
+			httpRequestDuration.Observe(
+				si.Latency.Seconds(),
+				si.Method,
+				si.Route,
+				strconv.Itoa(si.Status),
+			)
 			return
 		},
 	}))
@@ -153,6 +200,24 @@ func main() {
 	e.Use(middleware.NewError(middleware.ErrorConfig{
 		ResponseType: "json",
 	}))
+
+	// 全局并发请求限制（放在出错处理之后，保证出错能正常转换为响应）
+	// 健康检测与性能指标不限制，避免繁忙时存活检测失败导致重启
+	unlimitedRoutes := map[string]bool{
+		"/ping":   true,
+		"/health": true,
+	}
+	if metricsConfig.Path != "" {
+		unlimitedRoutes[metricsConfig.Path] = true
+	}
+	e.Use(M.NewRequestLimiter(M.RequestLimiterConfig{
+		Max:  basicConfig.RequestLimit,
+		Wait: basicConfig.RequestLimitWait,
+		Skipper: func(c *elton.Context) bool {
+			return c.Committed || unlimitedRoutes[c.Route]
+		},
+	}))
+
 	// 响应数据转换处理
 	e.Use(middleware.NewDefaultResponder())
 
@@ -171,6 +236,10 @@ func main() {
 			Msg("")
 		return
 	}
+	// 定时检测依赖服务，用于readiness检测
+	helper.HealthStartCheck(basicConfig.HealthCheckInterval)
+	// 接收到退出信号时优雅退出
+	go handleSignal(e)
 
 	addr := basicConfig.Listen
 	log.Info(context.Background()).
@@ -179,10 +248,96 @@ func main() {
 	// 监听端口
 	err = e.ListenAndServe(addr)
 	// 如果失败则直接panic，因为程序无法提供服务
-	if err != nil {
+	if err != nil && err != http.ErrServerClosed {
 		log.Error(context.Background()).
 			Err(err).
 			Msg("server listen fail")
 		panic(err)
 	}
+	// 等待关闭流程完成后再退出
+	<-shutdownDone
+}
+
+// 监听退出信号
+func handleSignal(e *elton.Elton) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+	s := <-c
+	gracefulShutdown(e, s.String())
+}
+
+// 执行关闭的步骤，超时则不再等待
+func runShutdownStep(step string, timeout time.Duration, fn func(ctx context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	startedAt := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- fn(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	event := log.Info(context.Background())
+	if err != nil {
+		event = log.Error(context.Background()).Err(err)
+	}
+	event.Str("category", "shutdown").
+		Str("step", step).
+		Str("use", time.Since(startedAt).String()).
+		Msg("")
+}
+
+// 优雅退出，停止接收请求，等待处理中的请求完成后关闭相关连接
+func gracefulShutdown(e *elton.Elton, reason string) {
+	shutdownOnce.Do(func() {
+		defer close(shutdownDone)
+		log.Info(context.Background()).
+			Str("category", "shutdown").
+			Str("reason", reason).
+			Int32("processing", util.GetProcessing()).
+			Msg("server is shutting down")
+		// 设置readiness检测失败，让负载均衡不再转发请求
+		helper.HealthSetClosing()
+		// 等待负载均衡检测到readiness失败，在此期间仍正常处理请求
+		if basicConfig.ShutdownDelay > 0 {
+			time.Sleep(basicConfig.ShutdownDelay)
+		}
+
+		// 停止接收新的请求，并等待处理中的请求完成
+		runShutdownStep("drain", basicConfig.DrainTimeout, func(ctx context.Context) error {
+			err := e.Server.Shutdown(ctx)
+			if err != nil {
+				return err
+			}
+			ticker := time.NewTicker(10 * time.Millisecond)
+			defer ticker.Stop()
+			for util.GetProcessing() > 0 {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-ticker.C:
+				}
+			}
+			return nil
+		})
+		// 关闭数据库连接
+		runShutdownStep("closeDatabase", basicConfig.CloseTimeout, func(_ context.Context) error {
+			return helper.EntClose()
+		})
+		// 关闭redis连接
+		runShutdownStep("closeRedis", basicConfig.CloseTimeout, func(_ context.Context) error {
+			return helper.RedisClose()
+		})
+		log.Info(context.Background()).
+			Str("category", "shutdown").
+			Msg("server is closed")
+		// 输出所有日志
+		runShutdownStep("flushLog", basicConfig.CloseTimeout, func(_ context.Context) error {
+			return log.Flush()
+		})
+	})
 }
@@ -0,0 +1,273 @@
+package metric
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 指标类型
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+// DefaultBuckets 默认的耗时分布区间(秒)
+var DefaultBuckets = []float64{
+	0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10,
+}
+
+type (
+	// collector 指标收集，用于输出prometheus格式数据
+	collector interface {
+		write(w *bufio.Writer)
+	}
+	// registry 已注册的指标
+	registry struct {
+		mutex      sync.RWMutex
+		collectors []collector
+	}
+
+	// series 某一组label对应的数据
+	series struct {
+		labelValues []string
+		value       float64
+		// histogram使用
+		buckets []uint64
+		count   uint64
+	}
+	// vec 带label的指标
+	vec struct {
+		mutex      sync.Mutex
+		name       string
+		help       string
+		metricType string
+		labelNames []string
+		buckets    []float64
+		series     map[string]*series
+	}
+
+	// CounterVec 计数器
+	CounterVec struct {
+		*vec
+	}
+	// HistogramVec 分布统计
+	HistogramVec struct {
+		*vec
+	}
+	// funcCollector 在输出时才获取数据的指标
+	funcCollector struct {
+		name       string
+		help       string
+		metricType string
+		fn         func() float64
+	}
+)
+
+var defaultRegistry = &registry{}
+
+func (r *registry) add(c collector) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+func newVec(name, help, metricType string, buckets []float64, labelNames []string) *vec {
+	v := &vec{
+		name:       name,
+		help:       help,
+		metricType: metricType,
+		labelNames: labelNames,
+		buckets:    buckets,
+		series:     make(map[string]*series),
+	}
+	defaultRegistry.add(v)
+	return v
+}
+
+// NewCounterVec 创建计数器并注册
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{
+		vec: newVec(name, help, typeCounter, nil, labelNames),
+	}
+}
+
+// NewHistogramVec 创建分布统计并注册，如果buckets为空则使用默认值
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	sorted := make([]float64, len(buckets))
+	copy(sorted, buckets)
+	sort.Float64s(sorted)
+	return &HistogramVec{
+		vec: newVec(name, help, typeHistogram, sorted, labelNames),
+	}
+}
+
+// NewGaugeFunc 创建在输出时才获取数据的gauge指标
+func NewGaugeFunc(name, help string, fn func() float64) {
+	defaultRegistry.add(&funcCollector{
+		name:       name,
+		help:       help,
+		metricType: typeGauge,
+		fn:         fn,
+	})
+}
+
+// NewCounterFunc 创建在输出时才获取数据的counter指标
+func NewCounterFunc(name, help string, fn func() float64) {
+	defaultRegistry.add(&funcCollector{
+		name:       name,
+		help:       help,
+		metricType: typeCounter,
+		fn:         fn,
+	})
+}
+
+// getSeries 获取label对应的数据，需要在加锁后调用
+func (v *vec) getSeries(labelValues []string) *series {
+	// 不足的label值以空字符串填充，多余的忽略
+	values := make([]string, len(v.labelNames))
+	copy(values, labelValues)
+	key := strings.Join(values, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{
+			labelValues: values,
+		}
+		if v.metricType == typeHistogram {
+			s.buckets = make([]uint64, len(v.buckets))
+		}
+		v.series[key] = s
+	}
+	return s
+}
+
+// Inc 计数+1
+func (cv *CounterVec) Inc(labelValues ...string) {
+	cv.Add(1, labelValues...)
+}
+
+// Add 计数增加指定值
+func (cv *CounterVec) Add(value float64, labelValues ...string) {
+	cv.mutex.Lock()
+	defer cv.mutex.Unlock()
+	cv.getSeries(labelValues).value += value
+}
+
+// Observe 记录数据
+func (hv *HistogramVec) Observe(value float64, labelValues ...string) {
+	hv.mutex.Lock()
+	defer hv.mutex.Unlock()
+	s := hv.getSeries(labelValues)
+	s.value += value
+	s.count++
+	for index, upper := range hv.buckets {
+		if value <= upper {
+			s.buckets[index]++
+			break
+		}
+	}
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+// formatLabels 生成label字符串，如{route="/users",status="200"}
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	sb := new(strings.Builder)
+	sb.WriteString("{")
+	for index, name := range names {
+		if index != 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString(name)
+		sb.WriteString(`="`)
+		sb.WriteString(labelValueReplacer.Replace(values[index]))
+		sb.WriteString(`"`)
+	}
+	if extraName != "" {
+		if len(names) != 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString(extraName)
+		sb.WriteString(`="`)
+		sb.WriteString(extraValue)
+		sb.WriteString(`"`)
+	}
+	sb.WriteString("}")
+	return sb.String()
+}
+
+func writeHeader(w *bufio.Writer, name, help, metricType string) {
+	w.WriteString("# HELP " + name + " " + help + "\n")
+	w.WriteString("# TYPE " + name + " " + metricType + "\n")
+}
+
+func (v *vec) write(w *bufio.Writer) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	writeHeader(w, v.name, v.help, v.metricType)
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := v.series[key]
+		if v.metricType != typeHistogram {
+			w.WriteString(v.name + formatLabels(v.labelNames, s.labelValues, "", "") + " " + formatFloat(s.value) + "\n")
+			continue
+		}
+		var cumulative uint64
+		for index, upper := range v.buckets {
+			cumulative += s.buckets[index]
+			labels := formatLabels(v.labelNames, s.labelValues, "le", formatFloat(upper))
+			w.WriteString(v.name + "_bucket" + labels + " " + strconv.FormatUint(cumulative, 10) + "\n")
+		}
+		labels := formatLabels(v.labelNames, s.labelValues, "le", "+Inf")
+		w.WriteString(v.name + "_bucket" + labels + " " + strconv.FormatUint(s.count, 10) + "\n")
+		labels = formatLabels(v.labelNames, s.labelValues, "", "")
+		w.WriteString(v.name + "_sum" + labels + " " + formatFloat(s.value) + "\n")
+		w.WriteString(v.name + "_count" + labels + " " + strconv.FormatUint(s.count, 10) + "\n")
+	}
+}
+
+func (fc *funcCollector) write(w *bufio.Writer) {
+	writeHeader(w, fc.name, fc.help, fc.metricType)
+	w.WriteString(fc.name + " " + formatFloat(fc.fn()) + "\n")
+}
+
+// WriteTo 以prometheus的文本格式输出所有指标
+func WriteTo(w io.Writer) error {
+	defaultRegistry.mutex.RLock()
+	collectors := make([]collector, len(defaultRegistry.collectors))
+	copy(collectors, defaultRegistry.collectors)
+	defaultRegistry.mutex.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/vicanso/beginner/cache"
+	"github.com/vicanso/beginner/cs"
+	"github.com/vicanso/beginner/ent"
+	"github.com/vicanso/beginner/ent/apitoken"
+	"github.com/vicanso/beginner/helper"
+	"github.com/vicanso/beginner/log"
+	"github.com/vicanso/beginner/schema"
+	"github.com/vicanso/beginner/util"
+	"github.com/vicanso/elton"
+	session "github.com/vicanso/elton-session"
+	"github.com/vicanso/hes"
+)
+
+// ErrAPITokenInvalid API token无效或已过期
+var ErrAPITokenInvalid = &hes.Error{
+	Message:    "token无效或已过期",
+	StatusCode: http.StatusUnauthorized,
+	Category:   "auth",
+}
+
+const (
+	// API token保存在context中的key
+	apiTokenKey = "_apiToken"
+	// 最近使用时间的更新间隔，避免每次请求均更新数据库
+	apiTokenLastUsedInterval = time.Minute
+)
+
+// GetAPIToken 获取当前请求使用的API token，使用session认证时返回nil
+func GetAPIToken(c *elton.Context) *ent.APIToken {
+	value, ok := c.Get(apiTokenKey)
+	if !ok {
+		return nil
+	}
+	return value.(*ent.APIToken)
+}
+
+// apiTokenAllowMethod 判断token的权限范围是否允许该请求方法
+func apiTokenAllowMethod(scopes []string, method string) bool {
+	if util.ContainsAny(scopes, schema.APITokenScopeWrite) {
+		return true
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return util.ContainsAny(scopes, schema.APITokenScopeRead)
+	default:
+		return false
+	}
+}
+
+// updateAPITokenLastUsed 更新token的最近使用时间，失败时仅输出日志
+func updateAPITokenLastUsed(ctx context.Context, t *ent.APIToken) {
+	if t.LastUsedAt != nil && time.Since(*t.LastUsedAt) < apiTokenLastUsedInterval {
+		return
+	}
+	err := helper.EntGetClient().APIToken.UpdateOneID(t.ID).
+		SetLastUsedAt(time.Now()).
+		Exec(ctx)
+	if err != nil {
+		log.Error(ctx).
+			Str("category", "updateAPITokenFail").
+			Int("id", t.ID).
+			Err(err).
+			Msg("")
+	}
+}
+
+// setBearerSession 使用token认证时设置只读且包含账号的session，
+// 无session id，因此不会保存至store
+func setBearerSession(c *elton.Context, u *ent.User) error {
+	se := &session.Session{
+		Store: cache.GetRedisSession(),
+	}
+	err := se.Set(c.Context(), cs.SessionAccountKey, u.Account)
+	if err != nil {
+		return err
+	}
+	se.EnableReadonly()
+	c.Set(session.Key, se)
+	c.Set(loginUserKey, u)
+	ctx := util.SetAccount(c.Context(), u.Account)
+	c.WithContext(util.SetRoles(ctx, u.Roles))
+	return nil
+}
+
+// NewAPIToken 支持使用Authorization: Bearer <token>认证，作为session cookie之外的认证方式，
+// 需要添加在NewSession之前。认证成功后设置只读且包含账号的session，
+// 因此后续的权限校验与处理函数无需区分认证方式。未设置Bearer时则直接跳过
+func NewAPIToken() elton.Handler {
+	return func(c *elton.Context) error {
+		token := getBearerToken(c)
+		// jwt由NewJWT处理
+		if token == "" || util.JWTIsLike(token) {
+			return c.Next()
+		}
+		if !util.APITokenIsValid(token) {
+			return ErrAPITokenInvalid.Clone()
+		}
+		ctx := c.Context()
+		t, err := helper.EntGetClient().APIToken.Query().
+			Where(apitoken.TokenHashEQ(util.APITokenHash(token))).
+			Only(ctx)
+		if ent.IsNotFound(err) {
+			return ErrAPITokenInvalid.Clone()
+		}
+		if err != nil {
+			return err
+		}
+		// 已撤销或已过期的token均无效
+		if t.RevokedAt != nil ||
+			(t.ExpiredAt != nil && t.ExpiredAt.Before(time.Now())) {
+			return ErrAPITokenInvalid.Clone()
+		}
+		if !apiTokenAllowMethod(t.Scopes, c.Request.Method) {
+			return ErrForbidden.Clone()
+		}
+		u, err := getUserByAccount(ctx, t.Account)
+		if err != nil {
+			return err
+		}
+
+		err = setBearerSession(c, u)
+		if err != nil {
+			return err
+		}
+		c.Set(apiTokenKey, t)
+
+		updateAPITokenLastUsed(ctx, t)
+		return c.Next()
+	}
+}
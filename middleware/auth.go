@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/vicanso/beginner/cache"
+	"github.com/vicanso/beginner/cs"
+	"github.com/vicanso/beginner/ent"
+	"github.com/vicanso/beginner/ent/user"
+	"github.com/vicanso/beginner/helper"
+	"github.com/vicanso/beginner/schema"
+	"github.com/vicanso/beginner/util"
+	"github.com/vicanso/elton"
+	session "github.com/vicanso/elton-session"
+	"github.com/vicanso/hes"
+)
+
+var (
+	// ErrNeedLogin 未登录时的出错
+	ErrNeedLogin = &hes.Error{
+		Message:    "请先登录",
+		StatusCode: http.StatusUnauthorized,
+		Category:   "auth",
+	}
+	// ErrForbidden 无权限访问时的出错
+	ErrForbidden = &hes.Error{
+		Message:    "权限不足，禁止访问",
+		StatusCode: http.StatusForbidden,
+		Category:   "auth",
+	}
+	// ErrUserDisabled 用户被禁用时的出错
+	ErrUserDisabled = &hes.Error{
+		Message:    "账号已被禁用",
+		StatusCode: http.StatusForbidden,
+		Category:   "auth",
+	}
+)
+
+// 登录用户保存在context中的key
+const loginUserKey = "_loginUser"
+
+// 用户信息缓存，角色或状态调整后最多延迟此时长生效
+var userCache = cache.NewLRUCache(1024, 30*time.Second)
+
+// RemoveUserCache 删除用户信息缓存，在更新用户角色、状态等信息后调用
+func RemoveUserCache(account string) {
+	userCache.Remove(account)
+}
+
+// GetLoginUser 获取当前登录的用户，未登录时返回ErrNeedLogin，
+// 需要在session中间件之后使用
+func GetLoginUser(c *elton.Context) (*ent.User, error) {
+	// 同一请求多次校验时只获取一次
+	value, ok := c.Get(loginUserKey)
+	if ok {
+		return value.(*ent.User), nil
+	}
+	se := session.MustGet(c)
+	account := se.GetString(cs.SessionAccountKey)
+	if account == "" {
+		return nil, ErrNeedLogin.Clone()
+	}
+	u, err := getUserByAccount(c.Context(), account)
+	if err != nil {
+		return nil, err
+	}
+	c.Set(loginUserKey, u)
+	return u, nil
+}
+
+// getUserByAccount 获取账号对应的用户（优先从缓存获取），
+// 账号不存在时返回ErrNeedLogin
+func getUserByAccount(ctx context.Context, account string) (*ent.User, error) {
+	value, ok := userCache.Get(account)
+	if ok {
+		return value.(*ent.User), nil
+	}
+	u, err := helper.EntGetClient().User.Query().
+		Where(user.AccountEQ(account)).
+		Only(ctx)
+	// 账号不存在，则认为未登录
+	if ent.IsNotFound(err) {
+		return nil, ErrNeedLogin.Clone()
+	}
+	if err != nil {
+		return nil, err
+	}
+	userCache.Add(account, u)
+	return u, nil
+}
+
+// checkLoginUser 获取登录用户并校验是否被禁用，
+// 若校验函数返回false则为无权限
+func checkLoginUser(fn func(*ent.User) bool) elton.Handler {
+	return func(c *elton.Context) error {
+		u, err := GetLoginUser(c)
+		if err != nil {
+			return err
+		}
+		if u.Status == schema.StatusDisabled {
+			return ErrUserDisabled.Clone()
+		}
+		if fn != nil && !fn(u) {
+			return ErrForbidden.Clone()
+		}
+		return c.Next()
+	}
+}
+
+// NewCheckLogin 校验用户是否已登录
+func NewCheckLogin() elton.Handler {
+	return checkLoginUser(nil)
+}
+
+// NewCheckRoles 校验用户是否有指定角色，只要满足其中一个角色即可
+func NewCheckRoles(roles ...string) elton.Handler {
+	return checkLoginUser(func(u *ent.User) bool {
+		return util.ContainsAny(u.Roles, roles...)
+	})
+}
+
+// NewCheckGroups 校验用户是否属于指定分组，只要满足其中一个分组即可
+func NewCheckGroups(groups ...string) elton.Handler {
+	return checkLoginUser(func(u *ent.User) bool {
+		return util.ContainsAny(u.Groups, groups...)
+	})
+}
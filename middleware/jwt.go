@@ -0,0 +1,209 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/vicanso/beginner/cache"
+	"github.com/vicanso/beginner/log"
+	"github.com/vicanso/beginner/schema"
+	"github.com/vicanso/beginner/util"
+	"github.com/vicanso/elton"
+	"github.com/vicanso/hes"
+)
+
+// jwt的token类型
+const (
+	jwtTypeAccess  = "access"
+	jwtTypeRefresh = "refresh"
+)
+
+// jwt数据保存在context中的key
+const jwtClaimsKey = "_jwtClaims"
+
+var (
+	// ErrJWTInvalid jwt无效或已过期
+	ErrJWTInvalid = &hes.Error{
+		Message:    "token无效或已过期",
+		StatusCode: http.StatusUnauthorized,
+		Category:   "jwt",
+	}
+	// ErrJWTReused refresh token被重复使用，该系列的token均已撤销
+	ErrJWTReused = &hes.Error{
+		Message:    "token已被使用，请重新登录",
+		StatusCode: http.StatusUnauthorized,
+		Category:   "jwt",
+	}
+)
+
+var jwtSigner = mustNewJWTSigner()
+
+// JWTTokens 登录或刷新后返回的token
+type JWTTokens struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	TokenType    string `json:"tokenType"`
+	// access token的有效期（秒）
+	ExpiresIn int `json:"expiresIn"`
+}
+
+func mustNewJWTSigner() *util.JWTSigner {
+	signer, err := util.NewJWTSigner(scf.JWTAlgorithm, scf.JWTKey)
+	if err != nil {
+		panic(err)
+	}
+	return signer
+}
+
+// GetJWTClaims 获取当前请求access token的数据，非jwt认证时返回nil
+func GetJWTClaims(c *elton.Context) *util.JWTClaims {
+	value, ok := c.Get(jwtClaimsKey)
+	if !ok {
+		return nil
+	}
+	return value.(*util.JWTClaims)
+}
+
+// signJWTTokens 生成access与refresh token
+func signJWTTokens(account, family, refreshID string) (*JWTTokens, error) {
+	now := time.Now()
+	accessToken, err := jwtSigner.Sign(&util.JWTClaims{
+		ID:        util.GenXID(),
+		Subject:   account,
+		Type:      jwtTypeAccess,
+		Family:    family,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(scf.JWTAccessTTL).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := jwtSigner.Sign(&util.JWTClaims{
+		ID:        refreshID,
+		Subject:   account,
+		Type:      jwtTypeRefresh,
+		Family:    family,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(scf.JWTRefreshTTL).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &JWTTokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(scf.JWTAccessTTL.Seconds()),
+	}, nil
+}
+
+// JWTIssue 登录成功后生成access与refresh token，返回token与系列id，
+// 系列id记录至账号的session中，因此撤销账号session时refresh token也失效
+func JWTIssue(ctx context.Context, account string) (*JWTTokens, string, error) {
+	family := util.GenXID()
+	refreshID := util.GenXID()
+	err := cache.AddJWTFamily(ctx, family, account, refreshID)
+	if err != nil {
+		return nil, "", err
+	}
+	err = cache.AddAccountSession(ctx, account, family)
+	if err != nil {
+		return nil, "", err
+	}
+	tokens, err := signJWTTokens(account, family, refreshID)
+	if err != nil {
+		return nil, "", err
+	}
+	return tokens, family, nil
+}
+
+// JWTRefresh 使用refresh token生成新的token，旧的refresh token则失效，
+// 若已失效的refresh token被再次使用，则撤销整个系列
+func JWTRefresh(ctx context.Context, refreshToken string) (*JWTTokens, error) {
+	claims, err := jwtSigner.Verify(refreshToken)
+	if err != nil || claims.Type != jwtTypeRefresh || claims.Family == "" {
+		return nil, ErrJWTInvalid.Clone()
+	}
+	// 账号被禁用后不允许再刷新，并撤销该系列
+	u, err := getUserByAccount(ctx, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if u.Status == schema.StatusDisabled {
+		err = JWTRevoke(ctx, claims)
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrUserDisabled.Clone()
+	}
+	refreshID := util.GenXID()
+	result, err := cache.RotateJWTFamily(ctx, claims.Family, claims.ID, refreshID)
+	if err != nil {
+		return nil, err
+	}
+	switch result {
+	case cache.JWTRotateReused:
+		// refresh token可能已泄露
+		log.Warn(ctx).
+			Str("category", "jwtRefreshReused").
+			Str("account", claims.Subject).
+			Str("family", claims.Family).
+			Msg("")
+		err = cache.RemoveAccountSession(ctx, claims.Subject, claims.Family)
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrJWTReused.Clone()
+	case cache.JWTRotateSuccess:
+		return signJWTTokens(claims.Subject, claims.Family, refreshID)
+	default:
+		return nil, ErrJWTInvalid.Clone()
+	}
+}
+
+// JWTRevoke 撤销refresh token系列，用于退出登录。
+// access token为无状态的，因此在过期前仍可使用
+func JWTRevoke(ctx context.Context, claims *util.JWTClaims) error {
+	err := cache.RemoveJWTFamily(ctx, claims.Family)
+	if err != nil {
+		return err
+	}
+	return cache.RemoveAccountSession(ctx, claims.Subject, claims.Family)
+}
+
+// NewJWT 支持使用Authorization: Bearer <access token>认证，
+// 需要添加在NewSession之前，添加此中间件的路由分组则支持jwt模式。
+// 认证成功后设置只读且包含账号的session，未设置jwt时则直接跳过
+func NewJWT() elton.Handler {
+	return func(c *elton.Context) error {
+		token := getBearerToken(c)
+		if token == "" || !util.JWTIsLike(token) {
+			return c.Next()
+		}
+		claims, err := jwtSigner.Verify(token)
+		if err != nil || claims.Type != jwtTypeAccess {
+			return ErrJWTInvalid.Clone()
+		}
+		u, err := getUserByAccount(c.Context(), claims.Subject)
+		if err != nil {
+			return err
+		}
+		err = setBearerSession(c, u)
+		if err != nil {
+			return err
+		}
+		c.Set(jwtClaimsKey, claims)
+		return c.Next()
+	}
+}
+
+// getBearerToken 获取Authorization: Bearer <token>中的token
+func getBearerToken(c *elton.Context) string {
+	authorization := c.GetRequestHeader("Authorization")
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer "))
+}
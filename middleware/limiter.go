@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vicanso/beginner/log"
+	"github.com/vicanso/elton"
+	"github.com/vicanso/hes"
+)
+
+// ErrTooManyRequests 正在处理的请求过多时的出错
+var ErrTooManyRequests = &hes.Error{
+	Message:    "请求过多，请稍候再试",
+	StatusCode: http.StatusServiceUnavailable,
+	Category:   "tooManyRequests",
+}
+
+// RequestLimiterConfig 全局请求并发限制配置
+type RequestLimiterConfig struct {
+	// 最大的正在处理请求数
+	Max uint
+	// 超出限制时的等待时长，为0则直接拒绝
+	Wait time.Duration
+	// 响应头Retry-After的值，默认为1秒
+	RetryAfter time.Duration
+	// 返回true则不限制，如健康检测等
+	Skipper elton.Skipper
+}
+
+// NewRequestLimiter 创建全局请求并发限制中间件
+func NewRequestLimiter(config RequestLimiterConfig) elton.Handler {
+	if config.Max == 0 {
+		panic("max of request limiter should be gt 0")
+	}
+	retryAfter := config.RetryAfter
+	if retryAfter < time.Second {
+		retryAfter = time.Second
+	}
+	retryAfterValue := strconv.Itoa(int(retryAfter.Seconds()))
+	// 使用带缓冲的channel控制并发数
+	tokens := make(chan struct{}, config.Max)
+	acquire := func(c *elton.Context) bool {
+		select {
+		case tokens <- struct{}{}:
+			return true
+		default:
+		}
+		// 不等待则直接返回失败
+		if config.Wait <= 0 {
+			return false
+		}
+		timer := time.NewTimer(config.Wait)
+		defer timer.Stop()
+		select {
+		case tokens <- struct{}{}:
+			return true
+		case <-timer.C:
+			return false
+		case <-c.Context().Done():
+			return false
+		}
+	}
+	skipper := config.Skipper
+	if skipper == nil {
+		skipper = elton.DefaultSkipper
+	}
+	return func(c *elton.Context) error {
+		if skipper(c) {
+			return c.Next()
+		}
+		if !acquire(c) {
+			log.Warn(c.Context()).
+				Str("category", "tooManyRequests").
+				Str("ip", c.RealIP()).
+				Str("route", c.Route).
+				Str("uri", c.Request.RequestURI).
+				Int("processing", len(tokens)).
+				Msg("")
+			c.SetHeader("Retry-After", retryAfterValue)
+			return ErrTooManyRequests.Clone()
+		}
+		defer func() {
+			<-tokens
+		}()
+		return c.Next()
+	}
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/vicanso/elton"
+)
+
+// NewPrefixURL 创建删除url前缀的pre处理函数
+// 在路由匹配前将请求路径中的前缀删除，而RequestURI保持不变，
+// 因此访问日志中记录的仍是原始的请求地址
+func NewPrefixURL(prefixes ...string) elton.PreHandler {
+	list := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		prefix = "/" + strings.Trim(prefix, "/")
+		if prefix == "/" {
+			continue
+		}
+		list = append(list, prefix)
+	}
+	// 优先匹配较长的前缀
+	sort.Slice(list, func(i, j int) bool {
+		return len(list[i]) > len(list[j])
+	})
+	trim := func(path, prefix string) (string, bool) {
+		if !strings.HasPrefix(path, prefix) {
+			return path, false
+		}
+		rest := path[len(prefix):]
+		// 仅匹配完整的路径，如/api不匹配/apix
+		if rest != "" && rest[0] != '/' {
+			return path, false
+		}
+		if rest == "" {
+			rest = "/"
+		}
+		return rest, true
+	}
+	return func(req *http.Request) {
+		if len(list) == 0 {
+			return
+		}
+		for _, prefix := range list {
+			path, ok := trim(req.URL.Path, prefix)
+			if !ok {
+				continue
+			}
+			req.URL.Path = path
+			if req.URL.RawPath != "" {
+				req.URL.RawPath, _ = trim(req.URL.RawPath, prefix)
+			}
+			return
+		}
+	}
+}
@@ -1,8 +1,11 @@
 package middleware
 
 import (
+	"net/http"
+
 	"github.com/vicanso/beginner/cache"
 	"github.com/vicanso/beginner/config"
+	"github.com/vicanso/beginner/cs"
 	"github.com/vicanso/beginner/util"
 	"github.com/vicanso/elton"
 	session "github.com/vicanso/elton-session"
@@ -13,7 +16,7 @@ var scf = config.MustGetSessionConfig()
 // NewSession new session middleware
 func NewSession() elton.Handler {
 	store := cache.GetRedisSession()
-	return session.NewByCookie(session.CookieConfig{
+	fn := session.NewByCookie(session.CookieConfig{
 		// 数据存储
 		Store: store,
 		// cookie是否签名认证
@@ -31,4 +34,71 @@ func NewSession() elton.Handler {
 		// 是否设置http only
 		HttpOnly: true,
 	})
+	return func(c *elton.Context) error {
+		// 使用旧的密钥签名（非第一个密钥）的cookie，则使用当前密钥重新签名
+		cookie, index, err := c.GetSignedCookie(scf.Key)
+		if err == nil && index > 0 {
+			c.AddSignedCookie(&http.Cookie{
+				Name:     scf.Key,
+				Value:    cookie.Value,
+				Path:     scf.CookiePath,
+				MaxAge:   int(scf.TTL.Seconds()),
+				HttpOnly: true,
+			})
+		}
+		return fn(c)
+	}
+}
+
+// NewSessionAccount 将session中的账号与角色设置至context中，
+// 使得该请求的所有日志（包括访问日志、数据库与redis的日志）均带有账号，
+// 需要在NewSession之后使用
+func NewSessionAccount() elton.Handler {
+	return func(c *elton.Context) error {
+		ctx := c.Context()
+		// 使用token认证时已设置
+		if util.GetAccount(ctx) != "" {
+			return c.Next()
+		}
+		se := session.MustGet(c)
+		account := se.GetString(cs.SessionAccountKey)
+		if account == "" {
+			return c.Next()
+		}
+		ctx = util.SetAccount(ctx, account)
+		// 角色用于日志记录，获取失败不影响请求，由后续的权限校验处理。
+		// 获取的用户保存在context中，后续的权限校验不会再次查询
+		u, err := GetLoginUser(c)
+		if err == nil {
+			ctx = util.SetRoles(ctx, u.Roles)
+		}
+		c.WithContext(ctx)
+		return c.Next()
+	}
+}
+
+// DestroySession 删除当前session并清除cookie
+func DestroySession(c *elton.Context) error {
+	se := session.MustGet(c)
+	id := se.ID
+	account := se.GetString(cs.SessionAccountKey)
+	err := se.Destroy(c.Context())
+	if err != nil {
+		return err
+	}
+	if account != "" && id != "" {
+		err = cache.RemoveAccountSession(c.Context(), account, id)
+		if err != nil {
+			return err
+		}
+	}
+	// 设置cookie过期
+	c.AddSignedCookie(&http.Cookie{
+		Name:     scf.Key,
+		Value:    "",
+		Path:     scf.CookiePath,
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+	return nil
 }
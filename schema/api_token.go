@@ -0,0 +1,80 @@
+package schema
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// API token的权限范围
+const (
+	// APITokenScopeRead 仅允许只读的请求(GET、HEAD)
+	APITokenScopeRead = "read"
+	// APITokenScopeWrite 允许所有请求
+	APITokenScopeWrite = "write"
+)
+
+// APIToken holds the schema definition for the APIToken entity.
+type APIToken struct {
+	ent.Schema
+}
+
+// Mixin API token表的mixin
+func (APIToken) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		TimeMixin{},
+	}
+}
+
+// Fields API token表的字段配置
+func (APIToken) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("account").
+			NotEmpty().
+			Immutable().
+			Comment("token所属的用户账户"),
+		field.String("name").
+			NotEmpty().
+			Comment("token名称，用于区分用途"),
+		field.String("token_hash").
+			Sensitive().
+			NotEmpty().
+			Immutable().
+			Unique().
+			Comment("token的sha256，不保存原始token"),
+		field.String("prefix").
+			Immutable().
+			Comment("token的前缀，用于展示时区分token"),
+		field.Strings("scopes").
+			Comment("token的权限范围"),
+		field.Time("expired_at").
+			StructTag(`json:"expiredAt,omitempty" sql:"expired_at"`).
+			Optional().
+			Nillable().
+			Comment("过期时间，为空则不过期"),
+		field.Time("last_used_at").
+			StructTag(`json:"lastUsedAt,omitempty" sql:"last_used_at"`).
+			Optional().
+			Nillable().
+			Comment("最近使用时间"),
+		// 删除操作被hook禁止，因此撤销时设置撤销时间
+		field.Time("revoked_at").
+			StructTag(`json:"revokedAt,omitempty" sql:"revoked_at"`).
+			Optional().
+			Nillable().
+			Comment("撤销时间，为空则未撤销"),
+	}
+}
+
+// Edges of the APIToken.
+func (APIToken) Edges() []ent.Edge {
+	return nil
+}
+
+// Indexes API token表索引
+func (APIToken) Indexes() []ent.Index {
+	return []ent.Index{
+		// token_hash的唯一索引由字段的Unique生成
+		index.Fields("account"),
+	}
+}
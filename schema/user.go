@@ -43,7 +43,7 @@ func (User) Fields() []ent.Field {
 		field.String("password").
 			Sensitive().
 			NotEmpty().
-			Comment("用户密码，保存hash之后的值"),
+			Comment("用户密码，保存带算法与参数前缀的argon2id hash"),
 		field.String("name").
 			Optional().
 			Comment("用户名称"),
@@ -56,6 +56,18 @@ func (User) Fields() []ent.Field {
 		field.String("email").
 			Optional().
 			Comment("用户邮箱"),
+		field.Bool("email_verified").
+			StructTag(`json:"emailVerified" sql:"email_verified"`).
+			Default(false).
+			Comment("用户邮箱是否已验证"),
+		field.String("totp_secret").
+			Optional().
+			Sensitive().
+			Comment("两步验证的密钥，加密后保存"),
+		field.Strings("totp_recovery_codes").
+			StructTag(`json:"-"`).
+			Optional().
+			Comment("两步验证的恢复码，保存hash之后的值"),
 	}
 }
 
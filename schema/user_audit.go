@@ -0,0 +1,67 @@
+package schema
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// UserAudit holds the schema definition for the UserAudit entity.
+type UserAudit struct {
+	ent.Schema
+}
+
+// Mixin 用户变更记录表的mixin
+func (UserAudit) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		TimeMixin{},
+	}
+}
+
+// Fields 用户变更记录表的字段配置
+func (UserAudit) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("operator").
+			NotEmpty().
+			Immutable().
+			Comment("操作者账户"),
+		field.String("account").
+			NotEmpty().
+			Immutable().
+			Comment("被修改的用户账户"),
+		field.String("category").
+			NotEmpty().
+			Immutable().
+			Comment("修改的类别，如status、roles、groups"),
+		field.String("before").
+			Optional().
+			Immutable().
+			Comment("修改前的值（json）"),
+		field.String("after").
+			Optional().
+			Immutable().
+			Comment("修改后的值（json）"),
+		field.String("ip").
+			Optional().
+			Immutable().
+			Comment("操作者IP"),
+		field.String("trace_id").
+			StructTag(`json:"traceID" sql:"trace_id"`).
+			Optional().
+			Immutable().
+			Comment("请求的trace id，用于关联日志"),
+	}
+}
+
+// Edges of the UserAudit.
+func (UserAudit) Edges() []ent.Edge {
+	return nil
+}
+
+// Indexes 用户变更记录表索引
+func (UserAudit) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("account"),
+		index.Fields("operator"),
+	}
+}
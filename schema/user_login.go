@@ -0,0 +1,68 @@
+package schema
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// UserLogin holds the schema definition for the UserLogin entity.
+type UserLogin struct {
+	ent.Schema
+}
+
+// Mixin 登录记录表的mixin
+func (UserLogin) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		TimeMixin{},
+	}
+}
+
+// Fields 登录记录表的字段配置
+func (UserLogin) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("account").
+			NotEmpty().
+			Immutable().
+			Comment("登录账户"),
+		field.String("ip").
+			Immutable().
+			Comment("登录IP"),
+		field.String("user_agent").
+			StructTag(`json:"userAgent" sql:"user_agent"`).
+			Optional().
+			Immutable().
+			Comment("登录的user agent"),
+		// session id可用于伪造登录，不返回至客户端，是否有效由服务端判断
+		field.String("session_id").
+			Sensitive().
+			Optional().
+			Immutable().
+			Comment("登录的session id"),
+		field.String("trace_id").
+			StructTag(`json:"traceID" sql:"trace_id"`).
+			Optional().
+			Immutable().
+			Comment("登录请求的trace id，用于关联日志"),
+		field.Bool("success").
+			Immutable().
+			Comment("是否登录成功"),
+		field.String("reason").
+			Optional().
+			Immutable().
+			Comment("登录失败的原因"),
+	}
+}
+
+// Edges of the UserLogin.
+func (UserLogin) Edges() []ent.Edge {
+	return nil
+}
+
+// Indexes 登录记录表索引
+func (UserLogin) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("account"),
+		index.Fields("ip"),
+	}
+}
@@ -0,0 +1,33 @@
+package util
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// API token的前缀，方便在代码或日志中识别泄露的token
+const apiTokenPrefix = "bgn_"
+
+// APITokenGenerate 生成随机的API token
+func APITokenGenerate() (string, error) {
+	buf := make([]byte, 24)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	return apiTokenPrefix + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// APITokenIsValid 判断是否API token的格式
+func APITokenIsValid(token string) bool {
+	return strings.HasPrefix(token, apiTokenPrefix) && len(token) == len(apiTokenPrefix)+32
+}
+
+// APITokenHash API token的hash，token为随机生成因此使用sha256即可
+func APITokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
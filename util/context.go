@@ -22,6 +22,7 @@ type contextKey string
 
 const (
 	accountKey contextKey = "account"
+	rolesKey   contextKey = "roles"
 	traceIDKey contextKey = "traceID"
 )
 
@@ -44,6 +45,21 @@ func GetAccount(ctx context.Context) string {
 	return getStringFromContext(ctx, accountKey)
 }
 
+// SetRoles sets roles to context
+func SetRoles(ctx context.Context, roles []string) context.Context {
+	return context.WithValue(ctx, rolesKey, roles)
+}
+
+// GetRoles gets roles from context
+func GetRoles(ctx context.Context) []string {
+	v := ctx.Value(rolesKey)
+	if v == nil {
+		return nil
+	}
+	roles, _ := v.([]string)
+	return roles
+}
+
 // SetTraceID sets trace id to context
 func SetTraceID(ctx context.Context, traceID string) context.Context {
 	return context.WithValue(ctx, traceIDKey, traceID)
@@ -0,0 +1,73 @@
+package util
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+)
+
+// ErrCiphertextInvalid 密文格式不符合
+var ErrCiphertextInvalid = errors.New("ciphertext is invalid")
+
+// 根据密钥生成aes-256的key
+func newAESGCM(key string) (cipher.AEAD, error) {
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// AESEncrypt 使用aes-gcm加密，返回base64后的密文
+func AESEncrypt(key, plaintext string) (string, error) {
+	gcm, err := newAESGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+	// nonce放在密文之前
+	buf := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.RawStdEncoding.EncodeToString(buf), nil
+}
+
+// AESDecrypt 解密aes-gcm加密的数据
+func AESDecrypt(key, ciphertext string) (string, error) {
+	gcm, err := newAESGCM(key)
+	if err != nil {
+		return "", err
+	}
+	buf, err := base64.RawStdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", ErrCiphertextInvalid
+	}
+	size := gcm.NonceSize()
+	if len(buf) < size {
+		return "", ErrCiphertextInvalid
+	}
+	plaintext, err := gcm.Open(nil, buf[:size], buf[size:], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// HMACSign 使用hmac-sha256签名，返回base64(url)后的签名
+func HMACSign(key, data string) string {
+	h := hmac.New(sha256.New, []byte(key))
+	_, _ = h.Write([]byte(data))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// HMACVerify 校验hmac-sha256签名
+func HMACVerify(key, data, sign string) bool {
+	return hmac.Equal([]byte(HMACSign(key, data)), []byte(sign))
+}
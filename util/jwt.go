@@ -0,0 +1,159 @@
+package util
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// jwt的签名算法
+const (
+	JWTAlgorithmHS256 = "HS256"
+	JWTAlgorithmEdDSA = "EdDSA"
+)
+
+var (
+	// ErrJWTInvalid jwt格式或签名不符合
+	ErrJWTInvalid = errors.New("jwt is invalid")
+	// ErrJWTExpired jwt已过期
+	ErrJWTExpired = errors.New("jwt is expired")
+)
+
+var jwtBase64 = base64.RawURLEncoding
+
+type (
+	// JWTClaims jwt的数据
+	JWTClaims struct {
+		// token id
+		ID string `json:"jti"`
+		// 账号
+		Subject string `json:"sub"`
+		// token类型，access或refresh
+		Type string `json:"type"`
+		// refresh token的系列，同一次登录生成的token属于同一系列
+		Family string `json:"fam,omitempty"`
+		// 生成时间
+		IssuedAt int64 `json:"iat"`
+		// 过期时间
+		ExpiresAt int64 `json:"exp"`
+	}
+	jwtHeader struct {
+		Algorithm string `json:"alg"`
+		Type      string `json:"typ"`
+	}
+	// JWTSigner jwt的签名与校验
+	JWTSigner struct {
+		algorithm  string
+		hmacKey    []byte
+		privateKey ed25519.PrivateKey
+		publicKey  ed25519.PublicKey
+	}
+)
+
+// NewJWTSigner 创建jwt签名，HS256的key为密钥字符串，
+// EdDSA的key为base64后的ed25519私钥（32字节的seed或64字节的私钥）
+func NewJWTSigner(algorithm, key string) (*JWTSigner, error) {
+	signer := &JWTSigner{
+		algorithm: algorithm,
+	}
+	switch algorithm {
+	case JWTAlgorithmHS256:
+		signer.hmacKey = []byte(key)
+	case JWTAlgorithmEdDSA:
+		buf, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, err
+		}
+		switch len(buf) {
+		case ed25519.SeedSize:
+			signer.privateKey = ed25519.NewKeyFromSeed(buf)
+		case ed25519.PrivateKeySize:
+			signer.privateKey = ed25519.PrivateKey(buf)
+		default:
+			return nil, fmt.Errorf("ed25519 key size(%d) is invalid", len(buf))
+		}
+		signer.publicKey = signer.privateKey.Public().(ed25519.PublicKey)
+	default:
+		return nil, fmt.Errorf("jwt algorithm(%s) is not support", algorithm)
+	}
+	return signer, nil
+}
+
+func (signer *JWTSigner) sign(data []byte) []byte {
+	if signer.algorithm == JWTAlgorithmEdDSA {
+		return ed25519.Sign(signer.privateKey, data)
+	}
+	h := hmac.New(sha256.New, signer.hmacKey)
+	_, _ = h.Write(data)
+	return h.Sum(nil)
+}
+
+func (signer *JWTSigner) verify(data, sig []byte) bool {
+	if signer.algorithm == JWTAlgorithmEdDSA {
+		return ed25519.Verify(signer.publicKey, data, sig)
+	}
+	return hmac.Equal(signer.sign(data), sig)
+}
+
+// Sign 生成jwt
+func (signer *JWTSigner) Sign(claims *JWTClaims) (string, error) {
+	header, err := json.Marshal(&jwtHeader{
+		Algorithm: signer.algorithm,
+		Type:      "JWT",
+	})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	data := jwtBase64.EncodeToString(header) + "." + jwtBase64.EncodeToString(payload)
+	return data + "." + jwtBase64.EncodeToString(signer.sign([]byte(data))), nil
+}
+
+// Verify 校验jwt的签名与有效期，返回jwt的数据
+func (signer *JWTSigner) Verify(token string) (*JWTClaims, error) {
+	arr := strings.Split(token, ".")
+	if len(arr) != 3 {
+		return nil, ErrJWTInvalid
+	}
+	buf, err := jwtBase64.DecodeString(arr[0])
+	if err != nil {
+		return nil, ErrJWTInvalid
+	}
+	header := jwtHeader{}
+	err = json.Unmarshal(buf, &header)
+	// 算法需与配置一致，避免使用none等算法绕过校验
+	if err != nil || header.Algorithm != signer.algorithm {
+		return nil, ErrJWTInvalid
+	}
+	sig, err := jwtBase64.DecodeString(arr[2])
+	if err != nil || !signer.verify([]byte(arr[0]+"."+arr[1]), sig) {
+		return nil, ErrJWTInvalid
+	}
+	buf, err = jwtBase64.DecodeString(arr[1])
+	if err != nil {
+		return nil, ErrJWTInvalid
+	}
+	claims := &JWTClaims{}
+	err = json.Unmarshal(buf, claims)
+	if err != nil {
+		return nil, ErrJWTInvalid
+	}
+	if claims.ExpiresAt <= time.Now().Unix() {
+		return nil, ErrJWTExpired
+	}
+	return claims, nil
+}
+
+// JWTIsLike 判断是否jwt的格式（仅判断是否由三部分组成）
+func JWTIsLike(token string) bool {
+	return strings.Count(token, ".") == 2
+}
@@ -0,0 +1,155 @@
+package util
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// 密码hash的算法
+const (
+	passwordAlgorithmArgon2id = "argon2id"
+	// 对旧的保存方式(前端的sha256)迁移生成的argon2id，
+	// 校验方式与argon2id一致，登录成功后重新生成为argon2id
+	passwordAlgorithmArgon2idLegacy = "argon2id-legacy"
+)
+
+// argon2id的参数，调整参数后旧的hash会在登录时重新生成
+const (
+	passwordArgon2Memory  uint32 = 19 * 1024
+	passwordArgon2Time    uint32 = 2
+	passwordArgon2Threads uint8  = 1
+	passwordArgon2KeyLen  uint32 = 32
+	passwordSaltLen              = 16
+)
+
+// ErrPasswordHashInvalid 密码hash格式不符合
+var ErrPasswordHashInvalid = errors.New("password hash is invalid")
+
+type passwordArgon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+var passwordBase64 = base64.RawStdEncoding
+
+// PasswordHash 生成密码的hash，格式如下：
+// $argon2id$v=19$m=19456,t=2,p=1$salt$hash
+func PasswordHash(password string) (string, error) {
+	return passwordHash(passwordAlgorithmArgon2id, password)
+}
+
+// PasswordWrapLegacy 将旧的保存方式(前端的sha256)迁移为argon2id，
+// 前端提交的仍为sha256，因此迁移后可直接校验，且不再保存原始的sha256
+func PasswordWrapLegacy(encoded string) (string, error) {
+	if !PasswordIsLegacy(encoded) {
+		return encoded, nil
+	}
+	return passwordHash(passwordAlgorithmArgon2idLegacy, encoded)
+}
+
+func passwordHash(algorithm, password string) (string, error) {
+	salt := make([]byte, passwordSaltLen)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey(
+		[]byte(password),
+		salt,
+		passwordArgon2Time,
+		passwordArgon2Memory,
+		passwordArgon2Threads,
+		passwordArgon2KeyLen,
+	)
+	return fmt.Sprintf(
+		"$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		algorithm,
+		argon2.Version,
+		passwordArgon2Memory,
+		passwordArgon2Time,
+		passwordArgon2Threads,
+		passwordBase64.EncodeToString(salt),
+		passwordBase64.EncodeToString(key),
+	), nil
+}
+
+// PasswordIsLegacy 判断是否旧的密码保存方式(直接保存前端的sha256)，
+// 需使用PasswordWrapLegacy迁移
+func PasswordIsLegacy(encoded string) bool {
+	return !strings.HasPrefix(encoded, "$")
+}
+
+func parsePasswordArgon2(encoded string) (*passwordArgon2Params, error) {
+	arr := strings.Split(encoded, "$")
+	// 以$开头，因此第一个为空字符串
+	if len(arr) != 6 ||
+		(arr[1] != passwordAlgorithmArgon2id && arr[1] != passwordAlgorithmArgon2idLegacy) {
+		return nil, ErrPasswordHashInvalid
+	}
+	var version int
+	_, err := fmt.Sscanf(arr[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return nil, ErrPasswordHashInvalid
+	}
+	params := &passwordArgon2Params{}
+	_, err = fmt.Sscanf(arr[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads)
+	if err != nil {
+		return nil, ErrPasswordHashInvalid
+	}
+	params.salt, err = passwordBase64.DecodeString(arr[4])
+	if err != nil {
+		return nil, ErrPasswordHashInvalid
+	}
+	params.key, err = passwordBase64.DecodeString(arr[5])
+	if err != nil || len(params.key) == 0 {
+		return nil, ErrPasswordHashInvalid
+	}
+	return params, nil
+}
+
+// PasswordVerify 校验密码与保存的hash是否一致
+func PasswordVerify(password, encoded string) (bool, error) {
+	// 旧的保存方式需先迁移（启动时执行），不再直接对比，否则可直接使用泄露的hash登录
+	if PasswordIsLegacy(encoded) {
+		return false, nil
+	}
+	params, err := parsePasswordArgon2(encoded)
+	if err != nil {
+		return false, err
+	}
+	key := argon2.IDKey(
+		[]byte(password),
+		params.salt,
+		params.time,
+		params.memory,
+		params.threads,
+		uint32(len(params.key)),
+	)
+	return subtle.ConstantTimeCompare(key, params.key) == 1, nil
+}
+
+// PasswordNeedsRehash 判断是否需要重新生成hash，
+// 旧的保存方式、迁移生成的hash或参数调整后均需要重新生成
+func PasswordNeedsRehash(encoded string) bool {
+	if PasswordIsLegacy(encoded) ||
+		strings.HasPrefix(encoded, "$"+passwordAlgorithmArgon2idLegacy+"$") {
+		return true
+	}
+	params, err := parsePasswordArgon2(encoded)
+	if err != nil {
+		return true
+	}
+	return params.memory != passwordArgon2Memory ||
+		params.time != passwordArgon2Time ||
+		params.threads != passwordArgon2Threads ||
+		len(params.key) != int(passwordArgon2KeyLen)
+}
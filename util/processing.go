@@ -0,0 +1,21 @@
+package util
+
+import "go.uber.org/atomic"
+
+// 当前正在处理的http请求数
+var processingCount = atomic.NewInt32(0)
+
+// IncProcessing 正在处理请求数+1
+func IncProcessing() int32 {
+	return processingCount.Inc()
+}
+
+// DecProcessing 正在处理请求数-1
+func DecProcessing() int32 {
+	return processingCount.Dec()
+}
+
+// GetProcessing 获取当前正在处理的请求数
+func GetProcessing() int32 {
+	return processingCount.Load()
+}
@@ -19,3 +19,15 @@ func CutRune(str string, max int) string {
 func GenXID() string {
 	return strings.ToUpper(xid.New().String())
 }
+
+// ContainsAny 判断字符串数组中是否包含任一值
+func ContainsAny(arr []string, values ...string) bool {
+	for _, item := range arr {
+		for _, value := range values {
+			if item == value {
+				return true
+			}
+		}
+	}
+	return false
+}
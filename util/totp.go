@@ -0,0 +1,115 @@
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// totp的参数（RFC 6238），使用通用的默认值，兼容大部分的验证器
+const (
+	totpPeriod    = 30
+	totpDigits    = 6
+	totpSecretLen = 20
+	// 允许前后偏差的时间窗口数
+	totpSkew = 1
+)
+
+var totpBase32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTPGenerateSecret 生成totp的密钥（base32）
+func TOTPGenerateSecret() (string, error) {
+	buf := make([]byte, totpSecretLen)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	return totpBase32.EncodeToString(buf), nil
+}
+
+// TOTPGetURI 获取用于生成二维码的otpauth地址
+func TOTPGetURI(issuer, account, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprintf("%d", totpDigits))
+	query.Set("period", fmt.Sprintf("%d", totpPeriod))
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// totpGenerateCode 根据时间步长生成验证码（RFC 4226）
+func totpGenerateCode(key []byte, step uint64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, step)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+// TOTPGenerateCode 生成指定时间的验证码
+func TOTPGenerateCode(secret string, t time.Time) (string, error) {
+	key, err := totpBase32.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	return totpGenerateCode(key, uint64(t.Unix()/totpPeriod)), nil
+}
+
+// TOTPValidate 校验验证码，允许前后一个时间窗口的偏差，
+// 校验成功时返回对应的时间步长，可用于防止验证码重复使用
+func TOTPValidate(secret, code string, t time.Time) (uint64, bool) {
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	key, err := totpBase32.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+	current := uint64(t.Unix() / totpPeriod)
+	for i := -totpSkew; i <= totpSkew; i++ {
+		step := uint64(int64(current) + int64(i))
+		expected := totpGenerateCode(key, step)
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// TOTPGenerateRecoveryCodes 生成一次性的恢复码，格式如：3f9a1-0c2b7
+func TOTPGenerateRecoveryCodes(count int) ([]string, error) {
+	codes := make([]string, count)
+	buf := make([]byte, 5)
+	for i := 0; i < count; i++ {
+		_, err := rand.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		code := fmt.Sprintf("%x", buf)
+		codes[i] = code[:5] + "-" + code[5:]
+	}
+	return codes, nil
+}
+
+// TOTPHashRecoveryCode 恢复码的hash，恢复码为随机生成因此使用sha256即可
+func TOTPHashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(code)))
+}
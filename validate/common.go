@@ -0,0 +1,37 @@
+package validate
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/spf13/cast"
+)
+
+// 分页查询的最大数量
+const maxLimit = 100
+
+func init() {
+	// 分页查询数量，1-100
+	Add("xLimit", func(fl validator.FieldLevel) bool {
+		value, err := cast.ToIntE(fl.Field().String())
+		if err != nil {
+			return false
+		}
+		return value > 0 && value <= maxLimit
+	})
+	// 分页查询偏移量
+	AddAlias("xOffset", "number,max=6")
+	// 布尔值
+	AddAlias("xBool", "oneof=true false 1 0")
+	// 状态（启用、禁用）
+	AddAlias("xStatus", "oneof=1 2")
+	// 时间，RFC3339格式
+	AddAlias("xDateTime", "datetime=2006-01-02T15:04:05Z07:00")
+	// cookie签名密钥
+	AddAlias("xSessionKey", "ascii,min=16,max=100")
+	// 时长，如30m、24h
+	Add("xDuration", func(fl validator.FieldLevel) bool {
+		value, err := time.ParseDuration(fl.Field().String())
+		return err == nil && value > 0
+	})
+}
@@ -1,8 +1,101 @@
 package validate
 
+import (
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/vicanso/beginner/schema"
+)
+
+// 用户列表可返回的字段
+var userFields = []string{
+	"id",
+	"account",
+	"name",
+	"roles",
+	"groups",
+	"email",
+	"emailVerified",
+	"status",
+	"createdAt",
+	"updatedAt",
+}
+
+// 用户角色
+var userRoles = []string{
+	schema.UserRoleNormal,
+	schema.UserRoleSu,
+	schema.UserRoleAdmin,
+}
+
+// newCommaListValidate 以,分隔的字符串校验，每个值均需满足校验函数
+func newCommaListValidate(fn func(value string) bool) validator.Func {
+	return func(fl validator.FieldLevel) bool {
+		for _, value := range strings.Split(fl.Field().String(), ",") {
+			if !fn(value) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// newCommaListInValidate 以,分隔的字符串校验，每个值均需在列表中
+func newCommaListInValidate(list []string) validator.Func {
+	return newCommaListValidate(func(value string) bool {
+		for _, item := range list {
+			if item == value {
+				return true
+			}
+		}
+		return false
+	})
+}
+
 func init() {
 	// 用户账号
 	AddAlias("xUserAccount", "ascii,min=2,max=10")
+	// 用户账号关键字（用于前缀查询）
+	AddAlias("xUserAccountKeyword", "ascii,min=1,max=10")
 	// 用户密码
 	AddAlias("xUserPassword", "ascii,min=6,max=50")
+	// 用户名称
+	AddAlias("xUserName", "min=1,max=20")
+	// 用户邮箱
+	AddAlias("xUserEmail", "email,max=50")
+	// API token名称
+	AddAlias("xAPITokenName", "min=1,max=30")
+	// API token权限范围
+	AddAlias("xAPITokenScope", "oneof=read write")
+	// 登录模式
+	AddAlias("xLoginMode", "oneof=cookie jwt")
+	// jwt
+	AddAlias("xJWT", "ascii,min=20,max=2000")
+	// 邮件中的token
+	AddAlias("xMailToken", "ascii,min=10,max=100")
+	// 两步验证的验证码(6位数字)或恢复码(如3f9a1-0c2b7)
+	AddAlias("xUserTOTPCode", "ascii,min=6,max=11")
+	// 用户列表排序字段，以-开头表示降序
+	AddAlias("xUserOrder", "oneof=id -id account -account createdAt -createdAt updatedAt -updatedAt")
+	// 用户角色
+	Add("xUserRole", func(fl validator.FieldLevel) bool {
+		value := fl.Field().String()
+		for _, role := range userRoles {
+			if role == value {
+				return true
+			}
+		}
+		return false
+	})
+	// 用户分组
+	AddAlias("xUserGroup", "min=1,max=20")
+	// 用户列表返回字段，以,分隔
+	Add("xUserFields", newCommaListInValidate(userFields))
+	// 用户角色，以,分隔
+	Add("xUserRoles", newCommaListInValidate(userRoles))
+	// 用户分组，以,分隔
+	Add("xUserGroups", newCommaListValidate(func(value string) bool {
+		size := len(value)
+		return size > 0 && size <= 20
+	}))
 }